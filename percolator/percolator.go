@@ -0,0 +1,226 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package percolator registers a set of queries once, then cheaply reports
+// which of them would match each new document as it arrives - the inverse
+// of a normal search, useful for alerting and routing. Each incoming
+// document is analyzed into an ephemeral in-memory index reusing bleve's
+// ordinary analysis pipeline, and registered queries are pruned to a
+// candidate subset with a term -> query IDs inverted index built from
+// whichever registered queries implement query.TermExtractableQuery,
+// before being evaluated for real against that document.
+package percolator
+
+import (
+	"fmt"
+	"sync"
+
+	bleve "github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// percolatorDocID is the document ID incoming documents are indexed under
+// in each ephemeral single-document index Match/MatchBatch builds. Its
+// value doesn't matter - each index holds exactly one document - it just
+// needs to be non-empty.
+const percolatorDocID = "_percolator_doc"
+
+// Percolator holds a set of registered queries and matches incoming
+// documents against them. A Percolator is safe for concurrent use.
+type Percolator struct {
+	mapping mapping.IndexMapping
+
+	mu sync.RWMutex
+	// queries holds every registered query, keyed by the ID it was
+	// registered under.
+	queries map[string]query.Query
+	// termIndex maps a field/term key (see termKey) to the set of
+	// registered query IDs whose ExtractTerms() included it; Match only
+	// needs to evaluate a document against the union of these sets for
+	// the terms it actually analyzes to, plus alwaysEvaluate.
+	termIndex map[string]map[string]struct{}
+	// alwaysEvaluate holds the IDs of queries that don't implement
+	// query.TermExtractableQuery (or report no terms), and so must be
+	// evaluated against every document regardless of its content.
+	alwaysEvaluate map[string]struct{}
+}
+
+// NewPercolator creates a Percolator whose ephemeral per-document indexes
+// are built using m.
+func NewPercolator(m mapping.IndexMapping) *Percolator {
+	return &Percolator{
+		mapping:        m,
+		queries:        map[string]query.Query{},
+		termIndex:      map[string]map[string]struct{}{},
+		alwaysEvaluate: map[string]struct{}{},
+	}
+}
+
+// Register adds q to the set of queries Match/MatchBatch consider, under
+// id. Registering an id that's already registered replaces it.
+func (p *Percolator) Register(id string, q query.Query) error {
+	if id == "" {
+		return fmt.Errorf("percolator: id must not be empty")
+	}
+	if q == nil {
+		return fmt.Errorf("percolator: query must not be nil")
+	}
+	if vq, ok := q.(query.ValidatableQuery); ok {
+		if err := vq.Validate(); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.unindexLocked(id)
+	p.queries[id] = q
+
+	if teq, ok := q.(query.TermExtractableQuery); ok {
+		terms := teq.ExtractTerms()
+		if len(terms) > 0 {
+			for _, t := range terms {
+				key := termKey(t.Field, t.Term)
+				ids, ok := p.termIndex[key]
+				if !ok {
+					ids = map[string]struct{}{}
+					p.termIndex[key] = ids
+				}
+				ids[id] = struct{}{}
+			}
+			return nil
+		}
+	}
+	p.alwaysEvaluate[id] = struct{}{}
+	return nil
+}
+
+// Unregister removes id, if present, from the set of queries Match /
+// MatchBatch consider.
+func (p *Percolator) Unregister(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.unindexLocked(id)
+	delete(p.queries, id)
+}
+
+// unindexLocked removes id from termIndex/alwaysEvaluate, without touching
+// p.queries; callers must hold p.mu.
+func (p *Percolator) unindexLocked(id string) {
+	delete(p.alwaysEvaluate, id)
+	for key, ids := range p.termIndex {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(p.termIndex, key)
+		}
+	}
+}
+
+// Match analyzes doc and returns the IDs of every registered query that
+// matches it.
+func (p *Percolator) Match(doc interface{}) ([]string, error) {
+	results, err := p.MatchBatch([]interface{}{doc})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// MatchBatch is like Match for several documents, holding the registry lock
+// once for the whole batch; each document still gets its own ephemeral index
+// and its own candidate set.
+func (p *Percolator) MatchBatch(docs []interface{}) ([][]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	rv := make([][]string, len(docs))
+	for i, doc := range docs {
+		matched, err := p.matchOneLocked(doc)
+		if err != nil {
+			return nil, fmt.Errorf("percolator: document %d: %w", i, err)
+		}
+		rv[i] = matched
+	}
+	return rv, nil
+}
+
+func (p *Percolator) matchOneLocked(doc interface{}) ([]string, error) {
+	idx, err := bleve.NewMemOnly(p.mapping)
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+
+	if err := idx.Index(percolatorDocID, doc); err != nil {
+		return nil, err
+	}
+
+	var matched []string
+	for id := range p.candidatesLocked(idx) {
+		q := p.queries[id]
+		req := bleve.NewSearchRequest(q)
+		req.Size = 1
+		res, err := idx.Search(req)
+		if err != nil {
+			return nil, fmt.Errorf("query %q: %w", id, err)
+		}
+		if res.Total > 0 {
+			matched = append(matched, id)
+		}
+	}
+	return matched, nil
+}
+
+// candidatesLocked returns the set of query IDs worth evaluating against
+// the single document just indexed into idx: every always-evaluate query,
+// plus every query whose term index entry matches a term the document was
+// actually analyzed to, discovered via idx.Fields()/idx.FieldDict().
+func (p *Percolator) candidatesLocked(idx bleve.Index) map[string]struct{} {
+	candidates := map[string]struct{}{}
+	for id := range p.alwaysEvaluate {
+		candidates[id] = struct{}{}
+	}
+
+	fields, err := idx.Fields()
+	if err != nil {
+		// Fall back to evaluating everything; losing the optimization is
+		// preferable to silently skipping queries.
+		for id := range p.queries {
+			candidates[id] = struct{}{}
+		}
+		return candidates
+	}
+
+	for _, field := range fields {
+		dict, err := idx.FieldDict(field)
+		if err != nil {
+			continue
+		}
+		for entry, err := dict.Next(); entry != nil && err == nil; entry, err = dict.Next() {
+			key := termKey(field, entry.Term)
+			for id := range p.termIndex[key] {
+				candidates[id] = struct{}{}
+			}
+		}
+		dict.Close()
+	}
+	return candidates
+}
+
+func termKey(field, term string) string {
+	return field + "\x00" + term
+}
@@ -0,0 +1,182 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package percolator
+
+import (
+	"context"
+	"testing"
+
+	bleve "github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// extractableQuery is a minimal query.TermExtractableQuery reporting a
+// fixed set of terms, used to exercise Register's indexing without needing
+// a real index.IndexReader/mapping.IndexMapping.
+type extractableQuery struct {
+	terms []query.ExtractedTerm
+}
+
+func (q *extractableQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	return nil, nil
+}
+
+func (q *extractableQuery) ExtractTerms() []query.ExtractedTerm {
+	return q.terms
+}
+
+func TestTermKey(t *testing.T) {
+	a := termKey("title", "dog")
+	b := termKey("tit", "ledog")
+	if a == b {
+		t.Fatalf("termKey collided: %q == %q", a, b)
+	}
+	if termKey("title", "dog") != termKey("title", "dog") {
+		t.Fatal("termKey not stable for identical inputs")
+	}
+}
+
+func TestRegisterIndexesExtractableQuery(t *testing.T) {
+	p := NewPercolator(nil)
+	q := &extractableQuery{terms: []query.ExtractedTerm{{Field: "title", Term: "dog"}}}
+
+	if err := p.Register("q1", q); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	if _, ok := p.alwaysEvaluate["q1"]; ok {
+		t.Fatal("q1 should not be in alwaysEvaluate; it extracted terms")
+	}
+	ids, ok := p.termIndex[termKey("title", "dog")]
+	if !ok {
+		t.Fatal("expected termIndex entry for title/dog")
+	}
+	if _, ok := ids["q1"]; !ok {
+		t.Fatal("expected q1 in termIndex for title/dog")
+	}
+}
+
+func TestRegisterFallsBackToAlwaysEvaluate(t *testing.T) {
+	p := NewPercolator(nil)
+	// A query reporting no terms (e.g. a PrefixQuery) must fall back to
+	// alwaysEvaluate rather than being silently dropped from candidates.
+	q := &extractableQuery{terms: nil}
+
+	if err := p.Register("q1", q); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, ok := p.alwaysEvaluate["q1"]; !ok {
+		t.Fatal("expected q1 in alwaysEvaluate when ExtractTerms reports no terms")
+	}
+}
+
+func TestUnregisterRemovesFromBothIndexes(t *testing.T) {
+	p := NewPercolator(nil)
+	extractable := &extractableQuery{terms: []query.ExtractedTerm{{Field: "title", Term: "dog"}}}
+	always := &extractableQuery{terms: nil}
+
+	if err := p.Register("extractable", extractable); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := p.Register("always", always); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	p.Unregister("extractable")
+	p.Unregister("always")
+
+	if _, ok := p.queries["extractable"]; ok {
+		t.Fatal("extractable query still registered")
+	}
+	if _, ok := p.queries["always"]; ok {
+		t.Fatal("always query still registered")
+	}
+	if _, ok := p.alwaysEvaluate["always"]; ok {
+		t.Fatal("always query still in alwaysEvaluate")
+	}
+	if ids, ok := p.termIndex[termKey("title", "dog")]; ok && len(ids) != 0 {
+		t.Fatal("termIndex entry still references unregistered query")
+	}
+}
+
+func TestRegisterEmptyIDRejected(t *testing.T) {
+	p := NewPercolator(nil)
+	if err := p.Register("", &extractableQuery{}); err == nil {
+		t.Fatal("expected error registering an empty id")
+	}
+}
+
+// TestMatchEndToEnd registers real queries against a real Percolator and
+// checks that Match/MatchBatch report exactly the ones a given document
+// should match, exercising the actual per-document index build, candidate
+// narrowing, and query evaluation rather than just the registry
+// bookkeeping the tests above cover.
+func TestMatchEndToEnd(t *testing.T) {
+	p := NewPercolator(bleve.NewIndexMapping())
+
+	dogQuery := query.NewTermQuery("dog")
+	dogQuery.SetField("title")
+	if err := p.Register("dog", dogQuery); err != nil {
+		t.Fatalf("Register(dog): %v", err)
+	}
+
+	catQuery := query.NewTermQuery("cat")
+	catQuery.SetField("title")
+	if err := p.Register("cat", catQuery); err != nil {
+		t.Fatalf("Register(cat): %v", err)
+	}
+
+	matched, err := p.Match(map[string]interface{}{"title": "a lazy dog sleeps"})
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+	if len(matched) != 1 || matched[0] != "dog" {
+		t.Fatalf("Match(dog doc) = %v, want [dog]", matched)
+	}
+
+	results, err := p.MatchBatch([]interface{}{
+		map[string]interface{}{"title": "a lazy dog sleeps"},
+		map[string]interface{}{"title": "a curious cat plays"},
+		map[string]interface{}{"title": "a bird sings"},
+	})
+	if err != nil {
+		t.Fatalf("MatchBatch: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("MatchBatch returned %d results, want 3", len(results))
+	}
+	if len(results[0]) != 1 || results[0][0] != "dog" {
+		t.Fatalf("MatchBatch[0] = %v, want [dog]", results[0])
+	}
+	if len(results[1]) != 1 || results[1][0] != "cat" {
+		t.Fatalf("MatchBatch[1] = %v, want [cat]", results[1])
+	}
+	if len(results[2]) != 0 {
+		t.Fatalf("MatchBatch[2] = %v, want no matches", results[2])
+	}
+
+	p.Unregister("dog")
+	matched, err = p.Match(map[string]interface{}{"title": "a lazy dog sleeps"})
+	if err != nil {
+		t.Fatalf("Match after Unregister(dog): %v", err)
+	}
+	if len(matched) != 0 {
+		t.Fatalf("Match after unregistering the only matching query = %v, want none", matched)
+	}
+}
@@ -15,6 +15,7 @@
 package query
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -96,243 +97,27 @@ func ParsePreSearchData(input []byte) (map[string]interface{}, error) {
 }
 
 // ParseQuery deserializes a JSON representation of
-// a Query object.
+// a Query object. It first looks for an explicit "type" discriminator
+// naming a query registered with RegisterQueryType; when absent, it falls
+// back to the detector each registered type was given, which recognizes
+// bleve's existing JSON query shapes by the keys they contain (e.g. a
+// "term" key means TermQuery). All of bleve's built-in query types are
+// themselves registered this way, in query_registry_builtin.go, so third
+// parties can add new ones (span queries, more-like-this, percolator,
+// function-score, etc.) without modifying this function.
 func ParseQuery(input []byte) (Query, error) {
 	var tmp map[string]interface{}
 	err := util.UnmarshalJSON(input, &tmp)
 	if err != nil {
 		return nil, err
 	}
-	_, hasFuzziness := tmp["fuzziness"]
-	_, isMatchQuery := tmp["match"]
-	_, isMatchPhraseQuery := tmp["match_phrase"]
-	_, hasTerms := tmp["terms"]
-	if hasFuzziness && !isMatchQuery && !isMatchPhraseQuery && !hasTerms {
-		var rv FuzzyQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	if isMatchQuery {
-		var rv MatchQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	if isMatchPhraseQuery {
-		var rv MatchPhraseQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	if hasTerms {
-		var rv PhraseQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			// now try multi-phrase
-			var rv2 MultiPhraseQuery
-			err = util.UnmarshalJSON(input, &rv2)
-			if err != nil {
-				return nil, err
-			}
-			return &rv2, nil
-		}
-		return &rv, nil
-	}
-	_, isTermQuery := tmp["term"]
-	if isTermQuery {
-		var rv TermQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasMust := tmp["must"]
-	_, hasShould := tmp["should"]
-	_, hasMustNot := tmp["must_not"]
-	if hasMust || hasShould || hasMustNot {
-		var rv BooleanQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasConjuncts := tmp["conjuncts"]
-	if hasConjuncts {
-		var rv ConjunctionQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasDisjuncts := tmp["disjuncts"]
-	if hasDisjuncts {
-		var rv DisjunctionQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
 
-	_, hasSyntaxQuery := tmp["query"]
-	if hasSyntaxQuery {
-		var rv QueryStringQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasMin := tmp["min"].(float64)
-	_, hasMax := tmp["max"].(float64)
-	if hasMin || hasMax {
-		var rv NumericRangeQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasMinStr := tmp["min"].(string)
-	_, hasMaxStr := tmp["max"].(string)
-	if hasMinStr || hasMaxStr {
-		var rv TermRangeQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasStart := tmp["start"]
-	_, hasEnd := tmp["end"]
-	if hasStart || hasEnd {
-		var rv DateRangeStringQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasPrefix := tmp["prefix"]
-	if hasPrefix {
-		var rv PrefixQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasRegexp := tmp["regexp"]
-	if hasRegexp {
-		var rv RegexpQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasWildcard := tmp["wildcard"]
-	if hasWildcard {
-		var rv WildcardQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasMatchAll := tmp["match_all"]
-	if hasMatchAll {
-		var rv MatchAllQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasMatchNone := tmp["match_none"]
-	if hasMatchNone {
-		var rv MatchNoneQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasDocIds := tmp["ids"]
-	if hasDocIds {
-		var rv DocIDQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasBool := tmp["bool"]
-	if hasBool {
-		var rv BoolFieldQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasTopLeft := tmp["top_left"]
-	_, hasBottomRight := tmp["bottom_right"]
-	if hasTopLeft && hasBottomRight {
-		var rv GeoBoundingBoxQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasDistance := tmp["distance"]
-	if hasDistance {
-		var rv GeoDistanceQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-	_, hasPoints := tmp["polygon_points"]
-	if hasPoints {
-		var rv GeoBoundingPolygonQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
-	}
-
-	_, hasGeo := tmp["geometry"]
-	if hasGeo {
-		var rv GeoShapeQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
+	rv, err := parseQueryViaRegistry(input, tmp)
+	if err != nil {
+		return nil, err
 	}
-
-	_, hasCIDR := tmp["cidr"]
-	if hasCIDR {
-		var rv IPRangeQuery
-		err := util.UnmarshalJSON(input, &rv)
-		if err != nil {
-			return nil, err
-		}
-		return &rv, nil
+	if rv != nil {
+		return rv, nil
 	}
 
 	return nil, fmt.Errorf("unknown query type")
@@ -403,12 +188,26 @@ func expandQuery(m mapping.IndexMapping, query Query) (Query, error) {
 
 // DumpQuery returns a string representation of the query tree, where query
 // string queries have been expanded into base queries. The output format is
-// meant for debugging purpose and may change in the future.
+// meant for debugging purpose and may change in the future. Where the root
+// query's concrete type was registered with RegisterQueryType, the dumped
+// object carries the same "type" discriminator ParseQuery would use to
+// parse it back, so the registry round-trips symmetrically.
 func DumpQuery(m mapping.IndexMapping, query Query) (string, error) {
 	q, err := expandQuery(m, query)
 	if err != nil {
 		return "", err
 	}
-	data, err := json.MarshalIndent(q, "", "  ")
-	return string(data), err
+	data, err := json.Marshal(q)
+	if err != nil {
+		return "", err
+	}
+	data, err = AddTypeDiscriminator(q, data)
+	if err != nil {
+		return "", err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return "", err
+	}
+	return indented.String(), nil
 }
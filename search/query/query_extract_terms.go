@@ -0,0 +1,130 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+// ExtractedTerm identifies a single field/term pair a query would match
+// against exactly, as reported by TermExtractableQuery. It intentionally
+// doesn't reach into bleve_index_api, since prefix/fuzzy clauses can only
+// ever report the literal prefix/term they were built with, not every
+// index term they might expand to.
+type ExtractedTerm struct {
+	Field string
+	Term  string
+}
+
+// TermExtractableQuery is implemented by queries that can report the exact
+// field/term pairs they're built from. It exists so consumers like the
+// percolator can build a term -> query inverted index and only evaluate
+// the candidate queries a given document could plausibly match, instead
+// of every registered query. Composite queries implement it by unioning
+// their children's extracted terms; a composite with any child that
+// cannot extract terms (e.g. a wildcard or numeric range clause) reports
+// no terms at all, which the percolator treats the same as the interface's
+// absence: "must evaluate against every document".
+type TermExtractableQuery interface {
+	Query
+	ExtractTerms() []ExtractedTerm
+}
+
+// ExtractTerms implements TermExtractableQuery. A query with no field set
+// searches the mapping's default field, which isn't known here, so it
+// reports no terms.
+func (q *TermQuery) ExtractTerms() []ExtractedTerm {
+	if q.FieldVal == "" {
+		return nil
+	}
+	return []ExtractedTerm{{Field: q.FieldVal, Term: q.Term}}
+}
+
+// ExtractTerms implements TermExtractableQuery. A prefix clause can match
+// any term sharing its prefix, not the prefix itself as an exact term, so it
+// reports no terms at all; callers that index by exact term (like the
+// percolator) fall back to evaluating it against every document rather than
+// missing matches whose term merely starts with, but isn't equal to, Prefix.
+func (q *PrefixQuery) ExtractTerms() []ExtractedTerm {
+	return nil
+}
+
+// ExtractTerms implements TermExtractableQuery; like TermQuery's, it reports
+// no terms when no field is set.
+func (q *PhraseQuery) ExtractTerms() []ExtractedTerm {
+	if q.FieldVal == "" {
+		return nil
+	}
+	terms := make([]ExtractedTerm, 0, len(q.Terms))
+	for _, t := range q.Terms {
+		terms = append(terms, ExtractedTerm{Field: q.FieldVal, Term: t})
+	}
+	return terms
+}
+
+// ExtractTerms implements TermExtractableQuery, returning the union of the
+// Must and Should clauses' terms. MustNot never makes a document match, so
+// it contributes nothing. If a set Must/Should clause doesn't implement the
+// interface or reports no terms, or neither is set, it reports no terms.
+func (q *BooleanQuery) ExtractTerms() []ExtractedTerm {
+	var terms []ExtractedTerm
+	for _, sub := range []Query{q.Must, q.Should} {
+		if sub == nil {
+			continue
+		}
+		teq, ok := sub.(TermExtractableQuery)
+		if !ok {
+			return nil
+		}
+		subTerms := teq.ExtractTerms()
+		if len(subTerms) == 0 {
+			return nil
+		}
+		terms = append(terms, subTerms...)
+	}
+	return terms
+}
+
+// ExtractTerms implements TermExtractableQuery, returning the union of the
+// conjuncts' terms, or no terms if any conjunct can't report any.
+func (q *ConjunctionQuery) ExtractTerms() []ExtractedTerm {
+	var terms []ExtractedTerm
+	for _, sub := range q.Conjuncts {
+		teq, ok := sub.(TermExtractableQuery)
+		if !ok {
+			return nil
+		}
+		subTerms := teq.ExtractTerms()
+		if len(subTerms) == 0 {
+			return nil
+		}
+		terms = append(terms, subTerms...)
+	}
+	return terms
+}
+
+// ExtractTerms implements TermExtractableQuery, returning the union of the
+// disjuncts' terms, or no terms if any disjunct can't report any.
+func (q *DisjunctionQuery) ExtractTerms() []ExtractedTerm {
+	var terms []ExtractedTerm
+	for _, sub := range q.Disjuncts {
+		teq, ok := sub.(TermExtractableQuery)
+		if !ok {
+			return nil
+		}
+		subTerms := teq.ExtractTerms()
+		if len(subTerms) == 0 {
+			return nil
+		}
+		terms = append(terms, subTerms...)
+	}
+	return terms
+}
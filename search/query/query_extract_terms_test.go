@@ -0,0 +1,48 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import "testing"
+
+func TestTermQueryExtractTerms(t *testing.T) {
+	q := &TermQuery{FieldVal: "title", Term: "dog"}
+	terms := q.ExtractTerms()
+	if len(terms) != 1 || terms[0].Field != "title" || terms[0].Term != "dog" {
+		t.Fatalf("ExtractTerms() = %+v, want [{title dog}]", terms)
+	}
+}
+
+func TestPrefixQueryExtractTermsReportsNone(t *testing.T) {
+	q := &PrefixQuery{FieldVal: "title", Prefix: "do"}
+	// A prefix clause can match any term sharing its prefix, not the
+	// prefix itself as an exact term, so it must report no extracted
+	// terms; consumers like the percolator rely on this to fall back to
+	// always evaluating it rather than indexing "do" as if it were an
+	// exact candidate term.
+	if terms := q.ExtractTerms(); terms != nil {
+		t.Fatalf("ExtractTerms() = %+v, want nil", terms)
+	}
+}
+
+func TestBooleanQueryExtractTermsIgnoresUnsetClauses(t *testing.T) {
+	must := &TermQuery{FieldVal: "title", Term: "dog"}
+	bq := &BooleanQuery{Must: must}
+	// Should and MustNot are unset, so the boolean reports exactly the
+	// Must clause's terms.
+	terms := bq.ExtractTerms()
+	if len(terms) != 1 || terms[0].Field != "title" || terms[0].Term != "dog" {
+		t.Fatalf("ExtractTerms() = %+v, want [{title dog}]", terms)
+	}
+}
@@ -0,0 +1,338 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/geo"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/scorer"
+	"github.com/blevesearch/bleve/v2/util"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// FieldValueFactorFunction rescales a hit by a (possibly transformed)
+// numeric field value: modifier(fieldValue) * Factor. Modifier is one of
+// "none" (the default), "log1p", "ln", "sqrt", or "reciprocal".
+type FieldValueFactorFunction struct {
+	Field    string  `json:"field"`
+	Factor   float64 `json:"factor,omitempty"`
+	Modifier string  `json:"modifier,omitempty"`
+}
+
+func (f *FieldValueFactorFunction) apply(value float64) (float64, error) {
+	factor := f.Factor
+	if factor == 0 {
+		factor = 1
+	}
+	switch f.Modifier {
+	case "", "none":
+		return value * factor, nil
+	case "log1p":
+		return math.Log1p(value) * factor, nil
+	case "ln":
+		return math.Log(value) * factor, nil
+	case "sqrt":
+		return math.Sqrt(value) * factor, nil
+	case "reciprocal":
+		if value == 0 {
+			return 0, fmt.Errorf("field_value_factor: reciprocal of zero")
+		}
+		return (1 / value) * factor, nil
+	default:
+		return 0, fmt.Errorf("field_value_factor: unknown modifier '%s'", f.Modifier)
+	}
+}
+
+// DecayFunction scores a hit by how far its field's value is from Origin,
+// using Scale as the distance at which the decayed score reaches Decay
+// (0.5 by default), offset by Offset positions of full score around
+// Origin. Field may be numeric, a date (RFC3339), or a geopoint, in which
+// case Origin/Scale/Offset are values geo.ParsePoint understands and the
+// distance used is the great-circle distance in kilometers.
+type DecayFunction struct {
+	Field  string      `json:"field"`
+	Origin interface{} `json:"origin"`
+	Scale  interface{} `json:"scale"`
+	Offset interface{} `json:"offset,omitempty"`
+	Decay  float64     `json:"decay,omitempty"`
+}
+
+// decayCurve is shared by gauss/exp/linear; only the shape of how score
+// falls off past Offset differs between them.
+type decayCurve func(distance, scale, decay float64) float64
+
+func gaussCurve(distance, scale, decay float64) float64 {
+	exponent := math.Log(decay) / (scale * scale)
+	return math.Exp(exponent * distance * distance)
+}
+
+func expCurve(distance, scale, decay float64) float64 {
+	exponent := math.Log(decay) / scale
+	return math.Exp(exponent * distance)
+}
+
+func linearCurve(distance, scale, decay float64) float64 {
+	score := 1 - (1-decay)*(distance/scale)
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// apply computes curve's value at value's distance from Origin. For a geo
+// field (Origin parses as a "lon,lat" point), that distance is the
+// great-circle distance in kilometers between value's Lon/Lat and Origin;
+// otherwise it's the absolute difference between value.Numeric and Origin
+// on the number line (dates included, since they arrive as epoch seconds).
+func (f *DecayFunction) apply(curve decayCurve, value scorer.FieldValue) (float64, error) {
+	scale, err := numericParam(f.Scale)
+	if err != nil {
+		return 0, fmt.Errorf("decay function: scale: %w", err)
+	}
+	if scale <= 0 {
+		return 0, fmt.Errorf("decay function: scale must be > 0")
+	}
+	decay := f.Decay
+	if decay <= 0 {
+		decay = 0.5
+	}
+
+	var distance float64
+	if originLon, originLat, ok := geoOrigin(f.Origin); ok {
+		distance = geo.Haversin(value.Lon, value.Lat, originLon, originLat)
+	} else {
+		origin, err := numericParam(f.Origin)
+		if err != nil {
+			return 0, fmt.Errorf("decay function: origin: %w", err)
+		}
+		distance = math.Abs(value.Numeric - origin)
+	}
+
+	var offset float64
+	if f.Offset != nil {
+		offset, err = numericParam(f.Offset)
+		if err != nil {
+			return 0, fmt.Errorf("decay function: offset: %w", err)
+		}
+	}
+	distance = math.Max(0, distance-offset)
+	return curve(distance, scale, decay), nil
+}
+
+// geoOrigin reports whether v is a "lon,lat" geopoint string, parsing it if
+// so. It exists because Origin's shape (geopoint vs. plain number/date)
+// decides whether apply computes a great-circle distance or a scalar one.
+func geoOrigin(v interface{}) (lon, lat float64, ok bool) {
+	s, isString := v.(string)
+	if !isString {
+		return 0, 0, false
+	}
+	return geo.ParsePoint(s)
+}
+
+// numericParam coerces a JSON-decoded scale/offset value, or a non-geo
+// origin, (number, numeric string, or RFC3339 date string) to a single
+// float64 usable for distance math. Geopoint origins are handled
+// separately, by geoOrigin and apply, since their distance to a document's
+// value is a great-circle distance between two points, not a scalar
+// subtraction.
+func numericParam(v interface{}) (float64, error) {
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return f, nil
+		}
+		if ts, err := time.Parse(time.RFC3339, t); err == nil {
+			return float64(ts.Unix()), nil
+		}
+		return 0, fmt.Errorf("could not parse '%s'", t)
+	default:
+		return 0, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+// ScoreFunction is one entry of FunctionScoreQuery's Functions list. Exactly
+// one of FieldValueFactor/Gauss/Exp/Linear should be set; Weight, if set
+// alongside one of them, scales its result, and alone acts as a constant
+// contribution.
+type ScoreFunction struct {
+	FieldValueFactor *FieldValueFactorFunction `json:"field_value_factor,omitempty"`
+	Gauss            *DecayFunction            `json:"gauss,omitempty"`
+	Exp              *DecayFunction            `json:"exp,omitempty"`
+	Linear           *DecayFunction            `json:"linear,omitempty"`
+	Weight           float64                   `json:"weight,omitempty"`
+}
+
+// decayFunction returns whichever of Gauss/Exp/Linear is set, paired with
+// its curve, or (nil, nil) if none is.
+func (sf *ScoreFunction) decayFunction() (*DecayFunction, decayCurve) {
+	switch {
+	case sf.Gauss != nil:
+		return sf.Gauss, gaussCurve
+	case sf.Exp != nil:
+		return sf.Exp, expCurve
+	case sf.Linear != nil:
+		return sf.Linear, linearCurve
+	default:
+		return nil, nil
+	}
+}
+
+// Field implements scorer.ScoreFunction.
+func (sf *ScoreFunction) Field() string {
+	if sf.FieldValueFactor != nil {
+		return sf.FieldValueFactor.Field
+	}
+	if df, _ := sf.decayFunction(); df != nil {
+		return df.Field
+	}
+	return ""
+}
+
+// IsGeo implements scorer.ScoreFunction, reporting whether Field names a
+// geopoint field, so FunctionScoreSearcher knows to decode its doc value
+// into Lon/Lat rather than Numeric. field_value_factor never applies to
+// geopoints, only decay functions do.
+func (sf *ScoreFunction) IsGeo() bool {
+	df, _ := sf.decayFunction()
+	if df == nil {
+		return false
+	}
+	_, _, ok := geoOrigin(df.Origin)
+	return ok
+}
+
+// Evaluate implements scorer.ScoreFunction.
+func (sf *ScoreFunction) Evaluate(value scorer.FieldValue) (float64, error) {
+	weight := sf.Weight
+	if weight == 0 {
+		weight = 1
+	}
+
+	if sf.FieldValueFactor != nil {
+		v, err := sf.FieldValueFactor.apply(value.Numeric)
+		return v * weight, err
+	}
+	if df, curve := sf.decayFunction(); df != nil {
+		v, err := df.apply(curve, value)
+		return v * weight, err
+	}
+	return weight, nil
+}
+
+// FunctionScoreQuery wraps Inner and rewrites each hit's score by combining
+// the base relevance score with one or more ScoreFunctions, each pulling
+// its field's value from the index reader at collect time. ScoreMode
+// combines the functions' results together (default "multiply"); BoostMode
+// combines that combined result with the base score (default "multiply").
+type FunctionScoreQuery struct {
+	Inner     Query           `json:"query"`
+	Functions []ScoreFunction `json:"functions"`
+	ScoreMode string          `json:"score_mode,omitempty"`
+	BoostMode string          `json:"boost_mode,omitempty"`
+	BoostVal  *Boost          `json:"boost,omitempty"`
+}
+
+// NewFunctionScoreQuery wraps inner, rescoring its hits with functions.
+func NewFunctionScoreQuery(inner Query, functions []ScoreFunction) *FunctionScoreQuery {
+	return &FunctionScoreQuery{Inner: inner, Functions: functions}
+}
+
+func (q *FunctionScoreQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *FunctionScoreQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *FunctionScoreQuery) Validate() error {
+	if q.Inner == nil {
+		return fmt.Errorf("function_score requires 'query'")
+	}
+	switch q.ScoreMode {
+	case "", "multiply", "sum", "avg", "first", "max", "min":
+	default:
+		return fmt.Errorf("function_score: unknown score_mode '%s'", q.ScoreMode)
+	}
+	switch q.BoostMode {
+	case "", "multiply", "replace", "sum", "avg", "max", "min":
+	default:
+		return fmt.Errorf("function_score: unknown boost_mode '%s'", q.BoostMode)
+	}
+	if vq, ok := q.Inner.(ValidatableQuery); ok {
+		return vq.Validate()
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler; Inner is typed as Query, an
+// interface encoding/json cannot instantiate without going back through
+// ParseQuery.
+func (q *FunctionScoreQuery) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Inner     json.RawMessage `json:"query"`
+		Functions []ScoreFunction `json:"functions"`
+		ScoreMode string          `json:"score_mode,omitempty"`
+		BoostMode string          `json:"boost_mode,omitempty"`
+		BoostVal  *Boost          `json:"boost,omitempty"`
+	}
+	if err := util.UnmarshalJSON(data, &tmp); err != nil {
+		return err
+	}
+	inner, err := ParseQuery(tmp.Inner)
+	if err != nil {
+		return err
+	}
+	q.Inner = inner
+	q.Functions = tmp.Functions
+	q.ScoreMode = tmp.ScoreMode
+	q.BoostMode = tmp.BoostMode
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
+
+func (q *FunctionScoreQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	inner, err := q.Inner.Searcher(ctx, i, m, options)
+	if err != nil {
+		return nil, err
+	}
+
+	fns := make([]scorer.ScoreFunction, len(q.Functions))
+	for idx := range q.Functions {
+		fns[idx] = &q.Functions[idx]
+	}
+
+	return scorer.NewFunctionScoreSearcher(inner, i, fns, q.ScoreMode, q.BoostMode)
+}
+
+func init() {
+	mustRegisterQueryType("function_score", func() Query { return &FunctionScoreQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["functions"]
+		return ok
+	})
+}
@@ -0,0 +1,202 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"math"
+	"testing"
+
+	bleve "github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/scorer"
+)
+
+func TestFieldValueFactorFunctionApply(t *testing.T) {
+	tests := []struct {
+		modifier string
+		factor   float64
+		value    float64
+		want     float64
+		wantErr  bool
+	}{
+		{"", 0, 4, 4, false}, // factor 0 defaults to 1
+		{"none", 2, 4, 8, false},
+		{"log1p", 1, 0, 0, false},
+		{"sqrt", 1, 9, 3, false},
+		{"reciprocal", 1, 2, 0.5, false},
+		{"reciprocal", 1, 0, 0, true},
+		{"bogus", 1, 1, 0, true},
+	}
+	for _, tc := range tests {
+		f := &FieldValueFactorFunction{Factor: tc.factor, Modifier: tc.modifier}
+		got, err := f.apply(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("modifier %q: expected error", tc.modifier)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("modifier %q: unexpected error: %v", tc.modifier, err)
+			continue
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("modifier %q: apply(%v) = %v, want %v", tc.modifier, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestDecayCurves(t *testing.T) {
+	// At distance 0, every curve returns full score (1.0).
+	if got := gaussCurve(0, 10, 0.5); math.Abs(got-1) > 1e-9 {
+		t.Errorf("gaussCurve(0, ...) = %v, want 1", got)
+	}
+	if got := expCurve(0, 10, 0.5); math.Abs(got-1) > 1e-9 {
+		t.Errorf("expCurve(0, ...) = %v, want 1", got)
+	}
+	if got := linearCurve(0, 10, 0.5); math.Abs(got-1) > 1e-9 {
+		t.Errorf("linearCurve(0, ...) = %v, want 1", got)
+	}
+
+	// At distance == scale, every curve returns decay.
+	if got := gaussCurve(10, 10, 0.5); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("gaussCurve(scale, ...) = %v, want 0.5", got)
+	}
+	if got := expCurve(10, 10, 0.5); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("expCurve(scale, ...) = %v, want 0.5", got)
+	}
+	if got := linearCurve(10, 10, 0.5); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("linearCurve(scale, ...) = %v, want 0.5", got)
+	}
+
+	// linearCurve never goes negative past the point where the line would.
+	if got := linearCurve(100, 10, 0.5); got != 0 {
+		t.Errorf("linearCurve(100, ...) = %v, want 0", got)
+	}
+}
+
+func TestNumericParam(t *testing.T) {
+	if v, err := numericParam(float64(42)); err != nil || v != 42 {
+		t.Errorf("numericParam(42.0) = %v, %v", v, err)
+	}
+	if v, err := numericParam("42"); err != nil || v != 42 {
+		t.Errorf("numericParam(\"42\") = %v, %v", v, err)
+	}
+	if _, err := numericParam("not a number"); err == nil {
+		t.Error("expected error for unparseable string")
+	}
+	if _, err := numericParam(true); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+}
+
+func TestFunctionScoreQueryValidate(t *testing.T) {
+	if err := (&FunctionScoreQuery{}).Validate(); err == nil {
+		t.Fatal("expected error when 'query' is missing")
+	}
+	q := &FunctionScoreQuery{Inner: &dummyRegistryQuery{}}
+	if err := q.Validate(); err != nil {
+		t.Fatalf("Validate with valid query: %v", err)
+	}
+	q.ScoreMode = "bogus"
+	if err := q.Validate(); err == nil {
+		t.Fatal("expected error for unknown score_mode")
+	}
+	q.ScoreMode = "multiply"
+	q.BoostMode = "bogus"
+	if err := q.Validate(); err == nil {
+		t.Fatal("expected error for unknown boost_mode")
+	}
+}
+
+func TestScoreFunctionEvaluateDefaultWeight(t *testing.T) {
+	sf := &ScoreFunction{}
+	got, err := sf.Evaluate(scorer.FieldValue{Numeric: 5})
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if got != 1 {
+		t.Fatalf("Evaluate with no function set = %v, want 1 (the default weight)", got)
+	}
+}
+
+func TestScoreFunctionIsGeo(t *testing.T) {
+	sf := &ScoreFunction{Gauss: &DecayFunction{Field: "loc", Origin: "40.7,-74.0", Scale: "10"}}
+	if !sf.IsGeo() {
+		t.Fatal("expected IsGeo() true for a gauss decay with a geopoint origin")
+	}
+
+	sf = &ScoreFunction{Gauss: &DecayFunction{Field: "age", Origin: "30", Scale: "10"}}
+	if sf.IsGeo() {
+		t.Fatal("expected IsGeo() false for a gauss decay with a numeric origin")
+	}
+
+	sf = &ScoreFunction{FieldValueFactor: &FieldValueFactorFunction{Field: "likes"}}
+	if sf.IsGeo() {
+		t.Fatal("expected IsGeo() false for field_value_factor")
+	}
+}
+
+func TestDecayFunctionApplyGeo(t *testing.T) {
+	// Origin and value are the same point, so distance is 0 and every
+	// curve should return full score regardless of scale/decay.
+	df := &DecayFunction{Field: "loc", Origin: "0,0", Scale: "100"}
+	got, err := df.apply(gaussCurve, scorer.FieldValue{Lon: 0, Lat: 0})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if math.Abs(got-1) > 1e-9 {
+		t.Fatalf("apply at origin = %v, want 1", got)
+	}
+}
+
+// TestFunctionScoreQueryEndToEnd indexes a couple of documents into a real
+// in-memory index and runs FunctionScoreQuery through Search, so the whole
+// path - Searcher construction, docValue reading the indexed numeric field
+// back out, and rescoring - is exercised together rather than just its
+// pieces in isolation.
+func TestFunctionScoreQueryEndToEnd(t *testing.T) {
+	idx, err := bleve.NewMemOnly(bleve.NewIndexMapping())
+	if err != nil {
+		t.Fatalf("NewMemOnly: %v", err)
+	}
+	defer idx.Close()
+
+	if err := idx.Index("alice", map[string]interface{}{"name": "alice", "likes": 10.0}); err != nil {
+		t.Fatalf("Index(alice): %v", err)
+	}
+	if err := idx.Index("bob", map[string]interface{}{"name": "bob", "likes": 100.0}); err != nil {
+		t.Fatalf("Index(bob): %v", err)
+	}
+
+	fsq := NewFunctionScoreQuery(NewMatchAllQuery(), []ScoreFunction{
+		{FieldValueFactor: &FieldValueFactorFunction{Field: "likes"}},
+	})
+
+	req := bleve.NewSearchRequest(fsq)
+	req.Size = 10
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if res.Total != 2 {
+		t.Fatalf("Total = %d, want 2", res.Total)
+	}
+	if len(res.Hits) != 2 || res.Hits[0].ID != "bob" || res.Hits[1].ID != "alice" {
+		t.Fatalf("Hits = %v, want [bob alice] (higher 'likes' scores higher)", res.Hits)
+	}
+	if res.Hits[0].Score <= res.Hits[1].Score {
+		t.Fatalf("bob's score (%v) should exceed alice's (%v)", res.Hits[0].Score, res.Hits[1].Score)
+	}
+}
@@ -0,0 +1,205 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// MatchIntervalRule matches the analyzed tokens of Query, in Field, as a
+// single interval spanning all of them, provided they can be laid out
+// within MaxGaps unmatched positions of one another. MaxGaps of -1 means
+// unbounded; Ordered requires the tokens to appear in Query's order.
+type MatchIntervalRule struct {
+	Query   string `json:"query"`
+	MaxGaps int    `json:"max_gaps"`
+	Ordered bool   `json:"ordered"`
+}
+
+// TermPatternIntervalRule backs both the "prefix" and "wildcard" leaf
+// rules: Term is either the literal prefix every matching index term must
+// start with, or a '*'/'?' wildcard pattern every matching index term must
+// satisfy. Every position any matching term occupies becomes its own
+// interval.
+type TermPatternIntervalRule struct {
+	Term string `json:"term"`
+}
+
+// FuzzyIntervalRule matches every position occupied by an index term
+// within Fuzziness edit-distance of Term, agreeing with it on its first
+// PrefixLength characters.
+type FuzzyIntervalRule struct {
+	Term         string `json:"term"`
+	Fuzziness    int    `json:"fuzziness"`
+	PrefixLength int    `json:"prefix_length"`
+}
+
+// CombinatorIntervalRule backs "all_of" (every one of Intervals must
+// match, combined the same way MatchIntervalRule combines a query's
+// tokens) and "any_of" (at least one of Intervals must match; MaxGaps/
+// Ordered are meaningless there and ignored).
+type CombinatorIntervalRule struct {
+	Intervals []IntervalRule `json:"intervals"`
+	MaxGaps   int            `json:"max_gaps"`
+	Ordered   bool           `json:"ordered"`
+}
+
+// BinaryIntervalRule backs every rule that relates one interval to
+// another: containing/contained_by, not_containing/not_contained_by,
+// overlapping/not_overlapping, and before/after. Rule is the operand whose
+// matching intervals are (conditionally) kept; Filter is compared against
+// it but never itself contributes intervals to the result.
+type BinaryIntervalRule struct {
+	Rule   IntervalRule `json:"rule"`
+	Filter IntervalRule `json:"filter"`
+}
+
+// IntervalRule is a tagged union of exactly one of the leaf or combinator
+// rule kinds; which field is non-nil determines the kind. It has no
+// "type" discriminator of its own because, unlike a top-level Query, it's
+// always a nested value whose key already names the variant (e.g. the
+// "match" key of an IntervalRule's enclosing object holds a
+// MatchIntervalRule).
+type IntervalRule struct {
+	Match          *MatchIntervalRule       `json:"match,omitempty"`
+	Prefix         *TermPatternIntervalRule `json:"prefix,omitempty"`
+	Wildcard       *TermPatternIntervalRule `json:"wildcard,omitempty"`
+	Fuzzy          *FuzzyIntervalRule       `json:"fuzzy,omitempty"`
+	AllOf          *CombinatorIntervalRule  `json:"all_of,omitempty"`
+	AnyOf          *CombinatorIntervalRule  `json:"any_of,omitempty"`
+	NotContaining  *BinaryIntervalRule      `json:"not_containing,omitempty"`
+	NotContainedBy *BinaryIntervalRule      `json:"not_contained_by,omitempty"`
+	Containing     *BinaryIntervalRule      `json:"containing,omitempty"`
+	ContainedBy    *BinaryIntervalRule      `json:"contained_by,omitempty"`
+	Overlapping    *BinaryIntervalRule      `json:"overlapping,omitempty"`
+	NotOverlapping *BinaryIntervalRule      `json:"not_overlapping,omitempty"`
+	Before         *BinaryIntervalRule      `json:"before,omitempty"`
+	After          *BinaryIntervalRule      `json:"after,omitempty"`
+}
+
+// Validate reports whether r names exactly one rule kind, recursing into
+// whichever nested rules it carries.
+func (r *IntervalRule) Validate() error {
+	set := 0
+	for _, b := range []bool{
+		r.Match != nil, r.Prefix != nil, r.Wildcard != nil, r.Fuzzy != nil,
+		r.AllOf != nil, r.AnyOf != nil, r.NotContaining != nil, r.NotContainedBy != nil,
+		r.Containing != nil, r.ContainedBy != nil, r.Overlapping != nil,
+		r.NotOverlapping != nil, r.Before != nil, r.After != nil,
+	} {
+		if b {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("interval rule must name exactly one of match/prefix/wildcard/fuzzy/all_of/any_of/(not_)containing/(not_)contained_by/(not_)overlapping/before/after, found %d", set)
+	}
+
+	switch {
+	case r.AllOf != nil:
+		return validateCombinator(r.AllOf)
+	case r.AnyOf != nil:
+		return validateCombinator(r.AnyOf)
+	case r.NotContaining != nil:
+		return validateBinary(r.NotContaining)
+	case r.NotContainedBy != nil:
+		return validateBinary(r.NotContainedBy)
+	case r.Containing != nil:
+		return validateBinary(r.Containing)
+	case r.ContainedBy != nil:
+		return validateBinary(r.ContainedBy)
+	case r.Overlapping != nil:
+		return validateBinary(r.Overlapping)
+	case r.NotOverlapping != nil:
+		return validateBinary(r.NotOverlapping)
+	case r.Before != nil:
+		return validateBinary(r.Before)
+	case r.After != nil:
+		return validateBinary(r.After)
+	}
+	return nil
+}
+
+func validateCombinator(c *CombinatorIntervalRule) error {
+	if len(c.Intervals) == 0 {
+		return fmt.Errorf("interval rule must have at least one sub-interval")
+	}
+	if c.MaxGaps < -1 {
+		return fmt.Errorf("interval rule max_gaps must be >= -1")
+	}
+	for i := range c.Intervals {
+		if err := c.Intervals[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateBinary(b *BinaryIntervalRule) error {
+	if err := b.Rule.Validate(); err != nil {
+		return err
+	}
+	return b.Filter.Validate()
+}
+
+// IntervalsQuery composes position-aware matching rules over Field,
+// independently of the phrase and span query families: a single rule tree
+// (built from MatchIntervalRule/TermPatternIntervalRule/FuzzyIntervalRule
+// leaves and CombinatorIntervalRule/BinaryIntervalRule combinators) decides
+// whether, and at which positions, a document matches.
+type IntervalsQuery struct {
+	Field    string       `json:"field"`
+	Rule     IntervalRule `json:"rule"`
+	BoostVal *Boost       `json:"boost,omitempty"`
+}
+
+// NewIntervalsQuery creates an IntervalsQuery evaluating rule against field.
+func NewIntervalsQuery(field string, rule IntervalRule) *IntervalsQuery {
+	return &IntervalsQuery{Field: field, Rule: rule}
+}
+
+func (q *IntervalsQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *IntervalsQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *IntervalsQuery) Validate() error {
+	if q.Field == "" {
+		return fmt.Errorf("intervals query requires 'field'")
+	}
+	return q.Rule.Validate()
+}
+
+func (q *IntervalsQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	return newIntervalsSearcher(ctx, i, m, q.Field, q.Rule, q.BoostVal.Value(), options)
+}
+
+func init() {
+	mustRegisterQueryType("intervals", func() Query { return &IntervalsQuery{} }, func(tmp map[string]interface{}) bool {
+		_, hasField := tmp["field"]
+		_, hasRule := tmp["rule"]
+		return hasField && hasRule
+	})
+}
@@ -0,0 +1,492 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/registry"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/searcher"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// intervalsSearcher evaluates an IntervalsQuery's rule tree against each
+// candidate document. The embedded DisjunctionSearcher, built over every
+// literal term the rule tree could possibly need, only narrows down
+// candidate documents (a superset of real matches); the rule tree itself
+// is (re-)evaluated per document from dm.Locations; documents where it
+// yields no interval are skipped.
+type intervalsSearcher struct {
+	*searcher.DisjunctionSearcher
+
+	field         string
+	rule          IntervalRule
+	matchTerms    map[*MatchIntervalRule][]string
+	expandedTerms map[interface{}][]string
+	boost         float64
+	spans         []search.Span
+}
+
+func newIntervalsSearcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping, field string,
+	rule IntervalRule, boost float64, options search.SearcherOptions) (search.Searcher, error) {
+	is := &intervalsSearcher{
+		field:         field,
+		rule:          rule,
+		matchTerms:    map[*MatchIntervalRule][]string{},
+		expandedTerms: map[interface{}][]string{},
+		boost:         boost,
+	}
+
+	needed := map[string]struct{}{}
+	if err := is.collectTerms(&rule, i, m, needed); err != nil {
+		return nil, err
+	}
+
+	// evaluate() derives every rule's intervals from dm.Locations, which the
+	// index only populates when term vectors are requested; force that on
+	// regardless of what the caller asked for.
+	termOptions := options
+	termOptions.IncludeTermVectors = true
+
+	termSearchers := make([]search.Searcher, 0, len(needed))
+	for term := range needed {
+		ts, err := searcher.NewTermSearcher(ctx, i, term, field, 1.0, termOptions)
+		if err != nil {
+			return nil, err
+		}
+		termSearchers = append(termSearchers, ts)
+	}
+
+	ds, err := searcher.NewDisjunctionSearcher(ctx, termSearchers, 1, options)
+	if err != nil {
+		return nil, err
+	}
+	is.DisjunctionSearcher = ds
+	return is, nil
+}
+
+// collectTerms walks rule, populating is.matchTerms/is.expandedTerms for
+// each leaf and adding every literal term a match could require to needed.
+func (is *intervalsSearcher) collectTerms(rule *IntervalRule, i index.IndexReader, m mapping.IndexMapping,
+	needed map[string]struct{}) error {
+	switch {
+	case rule.Match != nil:
+		tokens, err := analyzeToTerms(m, is.field, rule.Match.Query)
+		if err != nil {
+			return err
+		}
+		is.matchTerms[rule.Match] = tokens
+		for _, t := range tokens {
+			needed[t] = struct{}{}
+		}
+	case rule.Prefix != nil:
+		terms, err := expandByPrefix(i, is.field, rule.Prefix.Term)
+		if err != nil {
+			return err
+		}
+		is.expandedTerms[rule.Prefix] = terms
+		for _, t := range terms {
+			needed[t] = struct{}{}
+		}
+	case rule.Wildcard != nil:
+		terms, err := expandByPredicate(i, is.field, func(term string) bool {
+			return wildcardMatch(rule.Wildcard.Term, term)
+		})
+		if err != nil {
+			return err
+		}
+		is.expandedTerms[rule.Wildcard] = terms
+		for _, t := range terms {
+			needed[t] = struct{}{}
+		}
+	case rule.Fuzzy != nil:
+		terms, err := expandByPredicate(i, is.field, func(term string) bool {
+			return fuzzyMatch(rule.Fuzzy.Term, term, rule.Fuzzy.Fuzziness, rule.Fuzzy.PrefixLength)
+		})
+		if err != nil {
+			return err
+		}
+		is.expandedTerms[rule.Fuzzy] = terms
+		for _, t := range terms {
+			needed[t] = struct{}{}
+		}
+	case rule.AllOf != nil:
+		for idx := range rule.AllOf.Intervals {
+			if err := is.collectTerms(&rule.AllOf.Intervals[idx], i, m, needed); err != nil {
+				return err
+			}
+		}
+	case rule.AnyOf != nil:
+		for idx := range rule.AnyOf.Intervals {
+			if err := is.collectTerms(&rule.AnyOf.Intervals[idx], i, m, needed); err != nil {
+				return err
+			}
+		}
+	default:
+		// every remaining kind is a BinaryIntervalRule
+		b := binaryOf(rule)
+		if err := is.collectTerms(&b.Rule, i, m, needed); err != nil {
+			return err
+		}
+		if err := is.collectTerms(&b.Filter, i, m, needed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func binaryOf(rule *IntervalRule) *BinaryIntervalRule {
+	for _, b := range []*BinaryIntervalRule{
+		rule.NotContaining, rule.NotContainedBy, rule.Containing, rule.ContainedBy,
+		rule.Overlapping, rule.NotOverlapping, rule.Before, rule.After,
+	} {
+		if b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// analyzeToTerms tokenizes text with field's configured analyzer.
+func analyzeToTerms(m mapping.IndexMapping, field, text string) ([]string, error) {
+	analyzerName := m.AnalyzerNameForPath(field)
+	analyzer := registry.DefaultCache.AnalyzerNamed(analyzerName)
+	if analyzer == nil {
+		return nil, fmt.Errorf("no analyzer named '%s' for field '%s'", analyzerName, field)
+	}
+	tokens := analyzer.Analyze([]byte(text))
+	terms := make([]string, 0, len(tokens))
+	for _, tok := range tokens {
+		terms = append(terms, string(tok.Term))
+	}
+	return terms, nil
+}
+
+func expandByPrefix(i index.IndexReader, field, prefix string) ([]string, error) {
+	dict, err := i.FieldDictPrefix(field, []byte(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer dict.Close()
+	var terms []string
+	for entry, err := dict.Next(); entry != nil && err == nil; entry, err = dict.Next() {
+		terms = append(terms, entry.Term)
+	}
+	return terms, nil
+}
+
+func expandByPredicate(i index.IndexReader, field string, keep func(string) bool) ([]string, error) {
+	dict, err := i.FieldDict(field)
+	if err != nil {
+		return nil, err
+	}
+	defer dict.Close()
+	var terms []string
+	for entry, err := dict.Next(); entry != nil && err == nil; entry, err = dict.Next() {
+		if keep(entry.Term) {
+			terms = append(terms, entry.Term)
+		}
+	}
+	return terms, nil
+}
+
+// wildcardMatch reports whether term matches pattern, where '*' in
+// pattern matches any run of characters and '?' matches exactly one.
+func wildcardMatch(pattern, term string) bool {
+	var match func(p, t string) bool
+	match = func(p, t string) bool {
+		for len(p) > 0 {
+			switch p[0] {
+			case '*':
+				for j := 0; j <= len(t); j++ {
+					if match(p[1:], t[j:]) {
+						return true
+					}
+				}
+				return false
+			case '?':
+				if len(t) == 0 {
+					return false
+				}
+				p, t = p[1:], t[1:]
+			default:
+				if len(t) == 0 || p[0] != t[0] {
+					return false
+				}
+				p, t = p[1:], t[1:]
+			}
+		}
+		return len(t) == 0
+	}
+	return match(pattern, term)
+}
+
+// fuzzyMatch reports whether term's Levenshtein distance to pattern is at
+// most maxEdits, while sharing pattern's first prefixLen bytes.
+func fuzzyMatch(pattern, term string, maxEdits, prefixLen int) bool {
+	if prefixLen > 0 {
+		n := prefixLen
+		if n > len(pattern) {
+			n = len(pattern)
+		}
+		if !strings.HasPrefix(term, pattern[:n]) {
+			return false
+		}
+	}
+	return levenshtein(pattern, term) <= maxEdits
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(curr[j-1]+1, prev[j]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	m := a
+	if b < m {
+		m = b
+	}
+	if c < m {
+		m = c
+	}
+	return m
+}
+
+func (is *intervalsSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := is.DisjunctionSearcher.Next(ctx)
+	for dm != nil && err == nil {
+		if spans := is.evaluate(&is.rule, dm); len(spans) > 0 {
+			is.spans = spans
+			is.applyBoost(dm)
+			return dm, nil
+		}
+		dm, err = is.DisjunctionSearcher.Next(ctx)
+	}
+	return dm, err
+}
+
+func (is *intervalsSearcher) Advance(ctx *search.SearchContext, docID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := is.DisjunctionSearcher.Advance(ctx, docID)
+	for dm != nil && err == nil {
+		if spans := is.evaluate(&is.rule, dm); len(spans) > 0 {
+			is.spans = spans
+			is.applyBoost(dm)
+			return dm, nil
+		}
+		dm, err = is.DisjunctionSearcher.Next(ctx)
+	}
+	return dm, err
+}
+
+func (is *intervalsSearcher) applyBoost(dm *search.DocumentMatch) {
+	if is.boost != 0 && is.boost != 1 {
+		dm.Score *= is.boost
+	}
+}
+
+// Spans implements search.SpanSearcher, so an IntervalsQuery's matched
+// positions are inspectable the same way a span query's are.
+func (is *intervalsSearcher) Spans() search.SpanIterator {
+	return search.NewSliceSpanIterator(is.spans)
+}
+
+// evaluate computes the intervals rule produces for dm, recursing into
+// whichever kind of rule it is.
+func (is *intervalsSearcher) evaluate(rule *IntervalRule, dm *search.DocumentMatch) []search.Span {
+	switch {
+	case rule.Match != nil:
+		groups := make([][]search.Span, 0, len(is.matchTerms[rule.Match]))
+		for _, term := range is.matchTerms[rule.Match] {
+			groups = append(groups, termSpans(dm, is.field, term))
+		}
+		return combineSpanGroups(groups, rule.Match.MaxGaps, rule.Match.Ordered)
+	case rule.Prefix != nil:
+		return sortedUnion(termListSpans(dm, is.field, is.expandedTerms[rule.Prefix]))
+	case rule.Wildcard != nil:
+		return sortedUnion(termListSpans(dm, is.field, is.expandedTerms[rule.Wildcard]))
+	case rule.Fuzzy != nil:
+		return sortedUnion(termListSpans(dm, is.field, is.expandedTerms[rule.Fuzzy]))
+	case rule.AllOf != nil:
+		groups := make([][]search.Span, 0, len(rule.AllOf.Intervals))
+		for idx := range rule.AllOf.Intervals {
+			groups = append(groups, is.evaluate(&rule.AllOf.Intervals[idx], dm))
+		}
+		return combineSpanGroups(groups, rule.AllOf.MaxGaps, rule.AllOf.Ordered)
+	case rule.AnyOf != nil:
+		var all []search.Span
+		for idx := range rule.AnyOf.Intervals {
+			all = append(all, is.evaluate(&rule.AnyOf.Intervals[idx], dm)...)
+		}
+		return sortedUnion(all)
+	default:
+		b := binaryOf(rule)
+		base := is.evaluate(&b.Rule, dm)
+		filter := is.evaluate(&b.Filter, dm)
+		return filterSpans(rule, base, filter)
+	}
+}
+
+func filterSpans(rule *IntervalRule, base, filter []search.Span) []search.Span {
+	keep := func(pred func(r, f search.Span) bool, anyMatch bool) []search.Span {
+		var rv []search.Span
+		for _, r := range base {
+			matched := false
+			for _, f := range filter {
+				if pred(r, f) {
+					matched = true
+					break
+				}
+			}
+			if matched == anyMatch {
+				rv = append(rv, r)
+			}
+		}
+		return rv
+	}
+
+	contains := func(r, f search.Span) bool { return f.Start >= r.Start && f.End <= r.End }
+	containedBy := func(r, f search.Span) bool { return r.Start >= f.Start && r.End <= f.End }
+	overlaps := func(r, f search.Span) bool { return r.Overlaps(f) }
+	before := func(r, f search.Span) bool { return r.End < f.Start }
+	after := func(r, f search.Span) bool { return r.Start > f.End }
+
+	switch {
+	case rule.NotContaining != nil:
+		return keep(contains, false)
+	case rule.Containing != nil:
+		return keep(contains, true)
+	case rule.NotContainedBy != nil:
+		return keep(containedBy, false)
+	case rule.ContainedBy != nil:
+		return keep(containedBy, true)
+	case rule.Overlapping != nil:
+		return keep(overlaps, true)
+	case rule.NotOverlapping != nil:
+		return keep(overlaps, false)
+	case rule.Before != nil:
+		return keep(before, true)
+	case rule.After != nil:
+		return keep(after, true)
+	}
+	return nil
+}
+
+func termSpans(dm *search.DocumentMatch, field, term string) []search.Span {
+	return termListSpans(dm, field, []string{term})
+}
+
+func termListSpans(dm *search.DocumentMatch, field string, terms []string) []search.Span {
+	var spans []search.Span
+	fieldLocations, ok := dm.Locations[field]
+	if !ok {
+		return nil
+	}
+	for _, term := range terms {
+		for _, loc := range fieldLocations[term] {
+			spans = append(spans, search.Span{Start: loc.Pos, End: loc.Pos})
+		}
+	}
+	return sortedUnion(spans)
+}
+
+func sortedUnion(spans []search.Span) []search.Span {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	return spans
+}
+
+// combineSpanGroups looks for every way to pick one span from each of
+// groups, in order, such that consecutive picks are within maxGaps
+// unmatched positions of each other (maxGaps < 0 means unbounded) and,
+// when ordered is set, appear in non-decreasing Start order. Each
+// qualifying combination becomes one Span covering its full extent.
+func combineSpanGroups(groups [][]search.Span, maxGaps int, ordered bool) []search.Span {
+	if len(groups) == 0 {
+		return nil
+	}
+	for _, g := range groups {
+		if len(g) == 0 {
+			return nil
+		}
+	}
+
+	var results []search.Span
+	var rec func(idx int, prev *search.Span, lo, hi uint64)
+	rec = func(idx int, prev *search.Span, lo, hi uint64) {
+		if idx == len(groups) {
+			results = append(results, search.Span{Start: lo, End: hi})
+			return
+		}
+		for _, sp := range groups[idx] {
+			if prev != nil {
+				if ordered && sp.Start < prev.Start {
+					continue
+				}
+				if maxGaps >= 0 && intervalGap(*prev, sp) > maxGaps {
+					continue
+				}
+			}
+			nlo, nhi := lo, hi
+			if idx == 0 {
+				nlo, nhi = sp.Start, sp.End
+			} else {
+				if sp.Start < nlo {
+					nlo = sp.Start
+				}
+				if sp.End > nhi {
+					nhi = sp.End
+				}
+			}
+			spCopy := sp
+			rec(idx+1, &spCopy, nlo, nhi)
+		}
+	}
+	rec(0, nil, 0, 0)
+	return sortedUnion(results)
+}
+
+// intervalGap returns the number of unmatched positions separating a and
+// b, whichever comes first.
+func intervalGap(a, b search.Span) int {
+	var gap int64
+	if b.Start > a.End {
+		gap = int64(b.Start) - int64(a.End) - 1
+	} else if a.Start > b.End {
+		gap = int64(a.Start) - int64(b.End) - 1
+	}
+	if gap < 0 {
+		gap = 0
+	}
+	return int(gap)
+}
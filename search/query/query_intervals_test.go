@@ -0,0 +1,275 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/search"
+)
+
+func TestIntervalRuleValidateRequiresExactlyOneKind(t *testing.T) {
+	if err := (&IntervalRule{}).Validate(); err == nil {
+		t.Fatal("expected error when no rule kind is set")
+	}
+
+	both := &IntervalRule{
+		Match:  &MatchIntervalRule{Query: "dog"},
+		Prefix: &TermPatternIntervalRule{Term: "do"},
+	}
+	if err := both.Validate(); err == nil {
+		t.Fatal("expected error when more than one rule kind is set")
+	}
+
+	single := &IntervalRule{Match: &MatchIntervalRule{Query: "dog"}}
+	if err := single.Validate(); err != nil {
+		t.Fatalf("Validate with exactly one kind set: %v", err)
+	}
+}
+
+func TestCombinatorIntervalRuleValidate(t *testing.T) {
+	empty := &IntervalRule{AllOf: &CombinatorIntervalRule{}}
+	if err := empty.Validate(); err == nil {
+		t.Fatal("expected error for all_of with no sub-intervals")
+	}
+
+	badGaps := &IntervalRule{AllOf: &CombinatorIntervalRule{
+		Intervals: []IntervalRule{{Match: &MatchIntervalRule{Query: "dog"}}},
+		MaxGaps:   -2,
+	}}
+	if err := badGaps.Validate(); err == nil {
+		t.Fatal("expected error for max_gaps < -1")
+	}
+
+	ok := &IntervalRule{AnyOf: &CombinatorIntervalRule{
+		Intervals: []IntervalRule{{Match: &MatchIntervalRule{Query: "dog"}}},
+		MaxGaps:   -1,
+	}}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("Validate with valid any_of: %v", err)
+	}
+}
+
+func TestBinaryIntervalRuleValidateRecurses(t *testing.T) {
+	bad := &IntervalRule{Containing: &BinaryIntervalRule{
+		Rule:   IntervalRule{}, // neither side names a rule kind
+		Filter: IntervalRule{Match: &MatchIntervalRule{Query: "dog"}},
+	}}
+	if err := bad.Validate(); err == nil {
+		t.Fatal("expected error when Rule names no kind")
+	}
+
+	ok := &IntervalRule{Containing: &BinaryIntervalRule{
+		Rule:   IntervalRule{Match: &MatchIntervalRule{Query: "dog"}},
+		Filter: IntervalRule{Match: &MatchIntervalRule{Query: "cat"}},
+	}}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("Validate with valid containing rule: %v", err)
+	}
+}
+
+func TestIntervalsQueryValidate(t *testing.T) {
+	q := &IntervalsQuery{Rule: IntervalRule{Match: &MatchIntervalRule{Query: "dog"}}}
+	if err := q.Validate(); err == nil {
+		t.Fatal("expected error when field is missing")
+	}
+
+	q.Field = "title"
+	if err := q.Validate(); err != nil {
+		t.Fatalf("Validate with field and rule set: %v", err)
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, term string
+		want          bool
+	}{
+		{"qu*k", "quick", true},
+		{"qu*k", "quack", true},
+		{"b?at", "boat", true},
+		{"b?at", "bat", false},
+		{"*", "anything", true},
+		{"exact", "exact", true},
+		{"exact", "exacter", false},
+	}
+	for _, tc := range tests {
+		if got := wildcardMatch(tc.pattern, tc.term); got != tc.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tc.pattern, tc.term, got, tc.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"dog", "dog", 0},
+		{"dog", "dot", 1},
+		{"dog", "do", 1},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+	}
+	for _, tc := range tests {
+		if got := levenshtein(tc.a, tc.b); got != tc.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	if !fuzzyMatch("dog", "dot", 1, 0) {
+		t.Error("expected \"dot\" to fuzzy match \"dog\" within 1 edit")
+	}
+	if fuzzyMatch("dog", "cat", 1, 0) {
+		t.Error("expected \"cat\" not to fuzzy match \"dog\" within 1 edit")
+	}
+	// prefixLength requires the shared prefix to match exactly, regardless
+	// of how close the rest of the term is.
+	if fuzzyMatch("dog", "fog", 1, 1) {
+		t.Error("expected prefixLength=1 to reject a differing first character")
+	}
+	if !fuzzyMatch("dog", "dog", 1, 3) {
+		t.Error("expected an exact match to satisfy any prefixLength")
+	}
+}
+
+func TestCombineSpanGroups(t *testing.T) {
+	groups := [][]search.Span{
+		{{Start: 0, End: 0}},
+		{{Start: 1, End: 1}},
+	}
+	got := combineSpanGroups(groups, 0, true)
+	want := []search.Span{{Start: 0, End: 1}}
+	if len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("combineSpanGroups = %v, want %v", got, want)
+	}
+
+	// maxGaps=0 rejects picks separated by an unmatched position.
+	gappy := [][]search.Span{
+		{{Start: 0, End: 0}},
+		{{Start: 2, End: 2}},
+	}
+	if got := combineSpanGroups(gappy, 0, true); got != nil {
+		t.Fatalf("combineSpanGroups with a 1-position gap and maxGaps=0 = %v, want nil", got)
+	}
+	if got := combineSpanGroups(gappy, 1, true); len(got) != 1 {
+		t.Fatalf("combineSpanGroups with maxGaps=1 = %v, want one combined span", got)
+	}
+
+	// ordered=true rejects picks that run backwards.
+	backwards := [][]search.Span{
+		{{Start: 5, End: 5}},
+		{{Start: 1, End: 1}},
+	}
+	if got := combineSpanGroups(backwards, -1, true); got != nil {
+		t.Fatalf("combineSpanGroups ordered=true over backwards spans = %v, want nil", got)
+	}
+	if got := combineSpanGroups(backwards, -1, false); len(got) != 1 {
+		t.Fatalf("combineSpanGroups ordered=false over backwards spans = %v, want one combined span", got)
+	}
+
+	// an empty group makes the whole combination impossible.
+	if got := combineSpanGroups([][]search.Span{{{Start: 0, End: 0}}, nil}, -1, false); got != nil {
+		t.Fatalf("combineSpanGroups with an empty group = %v, want nil", got)
+	}
+}
+
+func TestFilterSpans(t *testing.T) {
+	base := []search.Span{{Start: 0, End: 5}, {Start: 10, End: 10}}
+	filter := []search.Span{{Start: 2, End: 3}}
+
+	containing := filterSpans(&IntervalRule{Containing: &BinaryIntervalRule{}}, base, filter)
+	if len(containing) != 1 || containing[0] != base[0] {
+		t.Fatalf("Containing = %v, want [%v]", containing, base[0])
+	}
+
+	notContaining := filterSpans(&IntervalRule{NotContaining: &BinaryIntervalRule{}}, base, filter)
+	if len(notContaining) != 1 || notContaining[0] != base[1] {
+		t.Fatalf("NotContaining = %v, want [%v]", notContaining, base[1])
+	}
+
+	before := filterSpans(&IntervalRule{Before: &BinaryIntervalRule{}}, base, []search.Span{{Start: 7, End: 7}})
+	if len(before) != 1 || before[0] != base[0] {
+		t.Fatalf("Before = %v, want [%v]", before, base[0])
+	}
+
+	after := filterSpans(&IntervalRule{After: &BinaryIntervalRule{}}, base, []search.Span{{Start: 7, End: 7}})
+	if len(after) != 1 || after[0] != base[1] {
+		t.Fatalf("After = %v, want [%v]", after, base[1])
+	}
+}
+
+// TestIntervalsSearcherEvaluate exercises evaluate end-to-end against a
+// DocumentMatch whose Locations are built by hand (quick, brown and fox at
+// positions 1-3, lazy at 7), in the same shape term vectors take on a
+// DocumentMatch, rather than just unit-testing evaluate's helpers in
+// isolation.
+func TestIntervalsSearcherEvaluate(t *testing.T) {
+	dm := &search.DocumentMatch{
+		Locations: search.FieldTermLocationMap{
+			"body": search.TermLocationMap{
+				"quick": {{Pos: 1}},
+				"brown": {{Pos: 2}},
+				"fox":   {{Pos: 3}},
+				"lazy":  {{Pos: 7}},
+			},
+		},
+	}
+
+	matchRule := &MatchIntervalRule{Query: "quick brown", MaxGaps: 0, Ordered: true}
+	is := &intervalsSearcher{
+		field:      "body",
+		matchTerms: map[*MatchIntervalRule][]string{matchRule: {"quick", "brown"}},
+	}
+	rule := IntervalRule{Match: matchRule}
+
+	spans := is.evaluate(&rule, dm)
+	if len(spans) != 1 || spans[0] != (search.Span{Start: 1, End: 2}) {
+		t.Fatalf("evaluate(quick brown) = %v, want a single span covering positions 1-2", spans)
+	}
+
+	// "brown quick", in that order, never occurs adjacently in the
+	// document, so an ordered match should find nothing.
+	reversedRule := &MatchIntervalRule{Query: "brown quick", MaxGaps: 0, Ordered: true}
+	is.matchTerms = map[*MatchIntervalRule][]string{reversedRule: {"brown", "quick"}}
+	if got := is.evaluate(&IntervalRule{Match: reversedRule}, dm); len(got) != 0 {
+		t.Fatalf("evaluate(brown quick, ordered) = %v, want no spans", got)
+	}
+
+	// containing(lazy) over an all_of(quick, fox) with unlimited gaps
+	// should drop the combined span (positions 1-3), since it doesn't
+	// contain position 7's "lazy".
+	allOf := &IntervalRule{AllOf: &CombinatorIntervalRule{
+		MaxGaps: -1,
+		Intervals: []IntervalRule{
+			{Match: &MatchIntervalRule{Query: "quick"}},
+			{Match: &MatchIntervalRule{Query: "fox"}},
+		},
+	}}
+	is.matchTerms = map[*MatchIntervalRule][]string{
+		allOf.AllOf.Intervals[0].Match: {"quick"},
+		allOf.AllOf.Intervals[1].Match: {"fox"},
+	}
+	containing := &IntervalRule{Containing: &BinaryIntervalRule{
+		Rule:   *allOf,
+		Filter: IntervalRule{Match: &MatchIntervalRule{Query: "lazy"}},
+	}}
+	is.matchTerms[containing.Containing.Filter.Match] = []string{"lazy"}
+	if got := is.evaluate(containing, dm); len(got) != 0 {
+		t.Fatalf("evaluate(containing lazy) = %v, want no spans (combined span 1-3 doesn't contain 'lazy' at 7)", got)
+	}
+}
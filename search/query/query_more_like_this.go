@@ -0,0 +1,292 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/registry"
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// Defaults for MoreLikeThisQuery, chosen to match what Lucene's
+// MoreLikeThis and most other MLT implementations default to.
+const (
+	DefaultMinTermFreq   = 2
+	DefaultMinDocFreq    = 5
+	DefaultMaxDocFreq    = 0 // 0 means unlimited
+	DefaultMinWordLen    = 0 // 0 means unlimited
+	DefaultMaxWordLen    = 0 // 0 means unlimited
+	DefaultMaxQueryTerms = 25
+)
+
+// MoreLikeThisQuery finds documents similar to either a block of raw seed
+// text or one or more existing documents, identified by LikeDocIDs. It
+// works by analyzing the seed (the text directly, or the named Fields of
+// the seed documents), scoring the resulting terms by tf * log(N/df), and
+// building an internal DisjunctionQuery of the highest scoring MaxQueryTerms
+// TermQuerys, each boosted by its score.
+type MoreLikeThisQuery struct {
+	LikeText      string   `json:"like,omitempty"`
+	LikeDocIDs    []string `json:"like_doc_ids,omitempty"`
+	Fields        []string `json:"fields,omitempty"`
+	Exclude       bool     `json:"exclude,omitempty"`
+	MinTermFreq   int      `json:"min_term_freq,omitempty"`
+	MinDocFreq    int      `json:"min_doc_freq,omitempty"`
+	MaxDocFreq    int      `json:"max_doc_freq,omitempty"`
+	MinWordLen    int      `json:"min_word_len,omitempty"`
+	MaxWordLen    int      `json:"max_word_len,omitempty"`
+	StopWords     []string `json:"stop_words,omitempty"`
+	MaxQueryTerms int      `json:"max_query_terms,omitempty"`
+	BoostVal      *Boost   `json:"boost,omitempty"`
+}
+
+// NewMoreLikeThisQuery creates a MoreLikeThisQuery seeded from raw text,
+// analyzed against Fields (or the default search field, if Fields is
+// empty) to build its internal term disjunction.
+func NewMoreLikeThisQuery(likeText string) *MoreLikeThisQuery {
+	return &MoreLikeThisQuery{
+		LikeText:      likeText,
+		MinTermFreq:   DefaultMinTermFreq,
+		MinDocFreq:    DefaultMinDocFreq,
+		MaxDocFreq:    DefaultMaxDocFreq,
+		MinWordLen:    DefaultMinWordLen,
+		MaxWordLen:    DefaultMaxWordLen,
+		MaxQueryTerms: DefaultMaxQueryTerms,
+	}
+}
+
+// NewMoreLikeThisQueryFromDocIDs creates a MoreLikeThisQuery seeded from
+// one or more existing documents, fetched and analyzed by the searcher
+// rather than supplied as text.
+func NewMoreLikeThisQueryFromDocIDs(likeDocIDs []string) *MoreLikeThisQuery {
+	return &MoreLikeThisQuery{
+		LikeDocIDs:    likeDocIDs,
+		MinTermFreq:   DefaultMinTermFreq,
+		MinDocFreq:    DefaultMinDocFreq,
+		MaxDocFreq:    DefaultMaxDocFreq,
+		MinWordLen:    DefaultMinWordLen,
+		MaxWordLen:    DefaultMaxWordLen,
+		MaxQueryTerms: DefaultMaxQueryTerms,
+	}
+}
+
+func (q *MoreLikeThisQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *MoreLikeThisQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *MoreLikeThisQuery) Validate() error {
+	if q.LikeText == "" && len(q.LikeDocIDs) == 0 {
+		return fmt.Errorf("more_like_this query must set either 'like' or 'like_doc_ids'")
+	}
+	return nil
+}
+
+// candidateTerm pairs a term with its running term frequency.
+type candidateTerm struct {
+	term string
+	tf   int
+}
+
+func (q *MoreLikeThisQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	fields := q.Fields
+	if len(fields) == 0 {
+		fields = []string{m.DefaultSearchField()}
+	}
+
+	// termFreqs is keyed by field first, so a term's frequency and the
+	// field it's scored against both reflect where it actually occurred,
+	// rather than being pooled across every field in Fields.
+	termFreqs := map[string]map[string]int{}
+	if q.LikeText != "" {
+		if err := q.analyzeText(m, fields, q.LikeText, termFreqs); err != nil {
+			return nil, err
+		}
+	}
+	for _, docID := range q.LikeDocIDs {
+		if err := q.analyzeDoc(i, m, fields, docID, termFreqs); err != nil {
+			return nil, err
+		}
+	}
+
+	numDocs, err := i.DocCount()
+	if err != nil {
+		return nil, err
+	}
+
+	stop := map[string]struct{}{}
+	for _, w := range q.StopWords {
+		stop[w] = struct{}{}
+	}
+
+	minWordLen := q.MinWordLen
+	maxWordLen := q.MaxWordLen
+	minTermFreq := q.MinTermFreq
+	if minTermFreq <= 0 {
+		minTermFreq = DefaultMinTermFreq
+	}
+	minDocFreq := q.MinDocFreq
+	if minDocFreq <= 0 {
+		minDocFreq = DefaultMinDocFreq
+	}
+	maxQueryTerms := q.MaxQueryTerms
+	if maxQueryTerms <= 0 {
+		maxQueryTerms = DefaultMaxQueryTerms
+	}
+
+	type scoredTerm struct {
+		term  string
+		field string
+		score float64
+	}
+	var scored []scoredTerm
+
+	for _, field := range fields {
+		for term, tf := range termFreqs[field] {
+			if _, excluded := stop[term]; excluded {
+				continue
+			}
+			if minWordLen > 0 && len(term) < minWordLen {
+				continue
+			}
+			if maxWordLen > 0 && len(term) > maxWordLen {
+				continue
+			}
+			if tf < minTermFreq {
+				continue
+			}
+
+			df, err := q.docFreq(ctx, i, field, term)
+			if err != nil {
+				return nil, err
+			}
+			if df == 0 || df < uint64(minDocFreq) {
+				continue
+			}
+			if q.MaxDocFreq > 0 && df > uint64(q.MaxDocFreq) {
+				continue
+			}
+
+			score := float64(tf) * math.Log(float64(numDocs)/float64(df))
+			scored = append(scored, scoredTerm{term: term, field: field, score: score})
+		}
+	}
+
+	sort.Slice(scored, func(a, b int) bool { return scored[a].score > scored[b].score })
+	if len(scored) > maxQueryTerms {
+		scored = scored[:maxQueryTerms]
+	}
+
+	disjuncts := make([]Query, 0, len(scored))
+	for _, st := range scored {
+		tq := NewTermQuery(st.term)
+		tq.SetField(st.field)
+		tq.SetBoost(st.score)
+		disjuncts = append(disjuncts, tq)
+	}
+
+	var inner Query = NewDisjunctionQuery(disjuncts)
+	if q.Exclude && len(q.LikeDocIDs) > 0 {
+		bq := NewBooleanQuery([]Query{inner}, nil, []Query{NewDocIDQuery(q.LikeDocIDs)})
+		inner = bq
+	}
+	if q.BoostVal != nil {
+		if bq, ok := inner.(BoostableQuery); ok {
+			bq.SetBoost(q.BoostVal.Value())
+		}
+	}
+
+	return inner.Searcher(ctx, i, m, options)
+}
+
+// analyzeText tokenizes text with each field's configured analyzer,
+// accumulating term frequencies into freqs[field], so a term is only ever
+// scored and queried against the field it actually occurred in.
+func (q *MoreLikeThisQuery) analyzeText(m mapping.IndexMapping, fields []string, text string, freqs map[string]map[string]int) error {
+	for _, field := range fields {
+		analyzerName := m.AnalyzerNameForPath(field)
+		analyzer := registry.DefaultCache.AnalyzerNamed(analyzerName)
+		if analyzer == nil {
+			return fmt.Errorf("no analyzer named '%s' for field '%s'", analyzerName, field)
+		}
+		tokens := analyzer.Analyze([]byte(text))
+		fieldFreqs, ok := freqs[field]
+		if !ok {
+			fieldFreqs = map[string]int{}
+			freqs[field] = fieldFreqs
+		}
+		for _, token := range tokens {
+			fieldFreqs[string(token.Term)]++
+		}
+	}
+	return nil
+}
+
+// analyzeDoc fetches docID's stored Fields and feeds their values through
+// analyzeText one field at a time, so a seed document contributes the same
+// way seed text does, without mixing one field's terms into another's.
+func (q *MoreLikeThisQuery) analyzeDoc(i index.IndexReader, m mapping.IndexMapping, fields []string, docID string, freqs map[string]map[string]int) error {
+	doc, err := i.Document(docID)
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		return fmt.Errorf("like_doc_ids: document '%s' not found", docID)
+	}
+
+	wanted := map[string]struct{}{}
+	for _, f := range fields {
+		wanted[f] = struct{}{}
+	}
+
+	doc.VisitFields(func(field index.Field) {
+		if _, ok := wanted[field.Name()]; !ok {
+			return
+		}
+		if err := q.analyzeText(m, []string{field.Name()}, string(field.Value()), freqs); err != nil {
+			logger.Printf("more_like_this: %v", err)
+		}
+	})
+	return nil
+}
+
+// docFreq returns the number of documents containing term in field.
+func (q *MoreLikeThisQuery) docFreq(ctx context.Context, i index.IndexReader, field, term string) (uint64, error) {
+	tfr, err := i.TermFieldReader(ctx, []byte(term), field, false, false, false)
+	if err != nil {
+		return 0, err
+	}
+	defer tfr.Close()
+	return tfr.Count(), nil
+}
+
+func init() {
+	mustRegisterQueryType("more_like_this", func() Query { return &MoreLikeThisQuery{} }, func(tmp map[string]interface{}) bool {
+		_, hasLike := tmp["like"]
+		_, hasLikeDocIDs := tmp["like_doc_ids"]
+		return hasLike || hasLikeDocIDs
+	})
+}
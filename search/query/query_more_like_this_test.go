@@ -0,0 +1,122 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"testing"
+
+	bleve "github.com/blevesearch/bleve/v2"
+)
+
+func TestNewMoreLikeThisQueryDefaults(t *testing.T) {
+	q := NewMoreLikeThisQuery("some text")
+	if q.LikeText != "some text" {
+		t.Fatalf("LikeText = %q, want %q", q.LikeText, "some text")
+	}
+	if q.MinTermFreq != DefaultMinTermFreq {
+		t.Fatalf("MinTermFreq = %d, want %d", q.MinTermFreq, DefaultMinTermFreq)
+	}
+	if q.MaxQueryTerms != DefaultMaxQueryTerms {
+		t.Fatalf("MaxQueryTerms = %d, want %d", q.MaxQueryTerms, DefaultMaxQueryTerms)
+	}
+}
+
+func TestNewMoreLikeThisQueryFromDocIDsDefaults(t *testing.T) {
+	q := NewMoreLikeThisQueryFromDocIDs([]string{"doc1", "doc2"})
+	if len(q.LikeDocIDs) != 2 {
+		t.Fatalf("LikeDocIDs = %v, want 2 entries", q.LikeDocIDs)
+	}
+	if q.MinDocFreq != DefaultMinDocFreq {
+		t.Fatalf("MinDocFreq = %d, want %d", q.MinDocFreq, DefaultMinDocFreq)
+	}
+}
+
+func TestMoreLikeThisQueryValidate(t *testing.T) {
+	if err := (&MoreLikeThisQuery{}).Validate(); err == nil {
+		t.Fatal("expected error when neither like nor like_doc_ids is set")
+	}
+	if err := (&MoreLikeThisQuery{LikeText: "x"}).Validate(); err != nil {
+		t.Fatalf("Validate with LikeText set: %v", err)
+	}
+	if err := (&MoreLikeThisQuery{LikeDocIDs: []string{"a"}}).Validate(); err != nil {
+		t.Fatalf("Validate with LikeDocIDs set: %v", err)
+	}
+}
+
+// TestMoreLikeThisQueryEndToEnd indexes a few documents into a real
+// in-memory index and runs MoreLikeThisQuery through Search, checking that
+// the tf*log(N/df) term scoring and doc-frequency filtering it builds on
+// top of actually surface similar documents and reject dissimilar ones.
+func TestMoreLikeThisQueryEndToEnd(t *testing.T) {
+	idx, err := bleve.NewMemOnly(bleve.NewIndexMapping())
+	if err != nil {
+		t.Fatalf("NewMemOnly: %v", err)
+	}
+	defer idx.Close()
+
+	docs := map[string]string{
+		"fox1":   "a quick quick brown fox jumps",
+		"fox2":   "a quick brown fox runs",
+		"orange": "totally unrelated content about oranges and grapefruit",
+	}
+	for id, body := range docs {
+		if err := idx.Index(id, map[string]interface{}{"body": body}); err != nil {
+			t.Fatalf("Index(%s): %v", id, err)
+		}
+	}
+
+	mlt := NewMoreLikeThisQuery("quick brown fox")
+	mlt.Fields = []string{"body"}
+	mlt.MinTermFreq = 1
+	mlt.MinDocFreq = 1
+
+	req := bleve.NewSearchRequest(mlt)
+	req.Size = 10
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	matched := map[string]bool{}
+	for _, hit := range res.Hits {
+		matched[hit.ID] = true
+	}
+	if !matched["fox1"] || !matched["fox2"] {
+		t.Fatalf("matched = %v, want fox1 and fox2 both matched", matched)
+	}
+	if matched["orange"] {
+		t.Fatalf("matched = %v, want orange excluded (shares no terms with the seed text)", matched)
+	}
+
+	// LikeDocIDs with Exclude should drop the seed document itself from
+	// its own results.
+	byDoc := NewMoreLikeThisQueryFromDocIDs([]string{"fox1"})
+	byDoc.Fields = []string{"body"}
+	byDoc.MinTermFreq = 1
+	byDoc.MinDocFreq = 1
+	byDoc.Exclude = true
+
+	req2 := bleve.NewSearchRequest(byDoc)
+	req2.Size = 10
+	res2, err := idx.Search(req2)
+	if err != nil {
+		t.Fatalf("Search (by doc id): %v", err)
+	}
+	for _, hit := range res2.Hits {
+		if hit.ID == "fox1" {
+			t.Fatalf("fox1 appeared in its own more_like_this results despite Exclude: %v", res2.Hits)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import "github.com/blevesearch/bleve/v2/util"
+
+// This file registers bleve's own query types with the RegisterQueryType
+// registry introduced alongside it. The detectors below are a direct
+// translation of the key-sniffing ladder ParseQuery used to contain, kept
+// in the exact same order so the legacy, discriminator-less JSON shapes
+// bleve has always accepted keep parsing exactly as before.
+func init() {
+	mustRegisterQueryType("fuzzy", func() Query { return &FuzzyQuery{} }, func(tmp map[string]interface{}) bool {
+		_, hasFuzziness := tmp["fuzziness"]
+		_, isMatchQuery := tmp["match"]
+		_, isMatchPhraseQuery := tmp["match_phrase"]
+		_, hasTerms := tmp["terms"]
+		return hasFuzziness && !isMatchQuery && !isMatchPhraseQuery && !hasTerms
+	})
+
+	mustRegisterQueryType("match", func() Query { return &MatchQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["match"]
+		return ok
+	})
+
+	mustRegisterQueryType("match_phrase", func() Query { return &MatchPhraseQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["match_phrase"]
+		return ok
+	})
+
+	// PhraseQuery and MultiPhraseQuery share the "terms" key: PhraseQuery's
+	// terms are strings, MultiPhraseQuery's are lists of strings. Resolve
+	// it the way ParseQuery always has, by trying PhraseQuery first and
+	// falling back to MultiPhraseQuery on unmarshal error.
+	if err := RegisterQueryTypeCustom("phrase", func(tmp map[string]interface{}) bool {
+		_, ok := tmp["terms"]
+		return ok
+	}, func(input []byte) (Query, error) {
+		var rv PhraseQuery
+		err := util.UnmarshalJSON(input, &rv)
+		if err != nil {
+			var rv2 MultiPhraseQuery
+			err = util.UnmarshalJSON(input, &rv2)
+			if err != nil {
+				return nil, err
+			}
+			return &rv2, nil
+		}
+		return &rv, nil
+	}, &PhraseQuery{}); err != nil {
+		panic(err)
+	}
+
+	mustRegisterQueryType("term", func() Query { return &TermQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["term"]
+		return ok
+	})
+
+	mustRegisterQueryType("boolean", func() Query { return &BooleanQuery{} }, func(tmp map[string]interface{}) bool {
+		_, hasMust := tmp["must"]
+		_, hasShould := tmp["should"]
+		_, hasMustNot := tmp["must_not"]
+		return hasMust || hasShould || hasMustNot
+	})
+
+	mustRegisterQueryType("conjunction", func() Query { return &ConjunctionQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["conjuncts"]
+		return ok
+	})
+
+	mustRegisterQueryType("disjunction", func() Query { return &DisjunctionQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["disjuncts"]
+		return ok
+	})
+
+	mustRegisterQueryType("query_string", func() Query { return &QueryStringQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["query"]
+		return ok
+	})
+
+	mustRegisterQueryType("numeric_range", func() Query { return &NumericRangeQuery{} }, func(tmp map[string]interface{}) bool {
+		_, hasMin := tmp["min"].(float64)
+		_, hasMax := tmp["max"].(float64)
+		return hasMin || hasMax
+	})
+
+	mustRegisterQueryType("term_range", func() Query { return &TermRangeQuery{} }, func(tmp map[string]interface{}) bool {
+		_, hasMin := tmp["min"].(string)
+		_, hasMax := tmp["max"].(string)
+		return hasMin || hasMax
+	})
+
+	mustRegisterQueryType("date_range", func() Query { return &DateRangeStringQuery{} }, func(tmp map[string]interface{}) bool {
+		_, hasStart := tmp["start"]
+		_, hasEnd := tmp["end"]
+		return hasStart || hasEnd
+	})
+
+	mustRegisterQueryType("prefix", func() Query { return &PrefixQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["prefix"]
+		return ok
+	})
+
+	mustRegisterQueryType("regexp", func() Query { return &RegexpQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["regexp"]
+		return ok
+	})
+
+	mustRegisterQueryType("wildcard", func() Query { return &WildcardQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["wildcard"]
+		return ok
+	})
+
+	mustRegisterQueryType("match_all", func() Query { return &MatchAllQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["match_all"]
+		return ok
+	})
+
+	mustRegisterQueryType("match_none", func() Query { return &MatchNoneQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["match_none"]
+		return ok
+	})
+
+	mustRegisterQueryType("doc_ids", func() Query { return &DocIDQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["ids"]
+		return ok
+	})
+
+	mustRegisterQueryType("bool_field", func() Query { return &BoolFieldQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["bool"]
+		return ok
+	})
+
+	mustRegisterQueryType("geo_bounding_box", func() Query { return &GeoBoundingBoxQuery{} }, func(tmp map[string]interface{}) bool {
+		_, hasTopLeft := tmp["top_left"]
+		_, hasBottomRight := tmp["bottom_right"]
+		return hasTopLeft && hasBottomRight
+	})
+
+	mustRegisterQueryType("geo_distance", func() Query { return &GeoDistanceQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["distance"]
+		return ok
+	})
+
+	mustRegisterQueryType("geo_bounding_polygon", func() Query { return &GeoBoundingPolygonQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["polygon_points"]
+		return ok
+	})
+
+	mustRegisterQueryType("geo_shape", func() Query { return &GeoShapeQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["geometry"]
+		return ok
+	})
+
+	mustRegisterQueryType("ip_range", func() Query { return &IPRangeQuery{} }, func(tmp map[string]interface{}) bool {
+		_, ok := tmp["cidr"]
+		return ok
+	})
+}
+
+func mustRegisterQueryType(name string, factory QueryTypeFactory, detect QueryTypeDetector) {
+	if err := RegisterQueryType(name, factory, detect); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,432 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/searcher"
+	"github.com/blevesearch/bleve/v2/util"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// SpanQuery is implemented by every member of the span query family
+// (SpanTermQuery and its combinators). Unlike a plain Query, its Searcher
+// is guaranteed to implement search.SpanSearcher, so span combinators can
+// be nested arbitrarily deep.
+type SpanQuery interface {
+	Query
+
+	SpanSearcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+		options search.SearcherOptions) (search.SpanSearcher, error)
+}
+
+// SpanTermQuery matches documents containing Term in Field, same as
+// TermQuery, but its Searcher additionally reports the matched positions
+// so it can sit beneath span_near/span_or/span_not/span_first.
+type SpanTermQuery struct {
+	Term     string `json:"term"`
+	FieldVal string `json:"field,omitempty"`
+	BoostVal *Boost `json:"boost,omitempty"`
+}
+
+// NewSpanTermQuery creates a SpanTermQuery for finding term in the default field.
+func NewSpanTermQuery(term string) *SpanTermQuery {
+	return &SpanTermQuery{Term: term}
+}
+
+func (q *SpanTermQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanTermQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *SpanTermQuery) SetField(f string) {
+	q.FieldVal = f
+}
+
+// MarshalJSON implements json.Marshaler. It's needed because span_term has
+// no legacy detector registered (see the init below), so without a "type"
+// discriminator of its own, a span_term nested inside another span query
+// would fail to round-trip back through ParseQuery.
+func (q *SpanTermQuery) MarshalJSON() ([]byte, error) {
+	type Alias SpanTermQuery
+	return MarshalQueryWithType(q, (*Alias)(q))
+}
+
+func (q *SpanTermQuery) Field() string {
+	return q.FieldVal
+}
+
+func (q *SpanTermQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	return q.SpanSearcher(ctx, i, m, options)
+}
+
+func (q *SpanTermQuery) SpanSearcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.SpanSearcher, error) {
+	field := q.FieldVal
+	if field == "" {
+		field = m.DefaultSearchField()
+	}
+	return searcher.NewSpanTermSearcher(ctx, i, q.Term, field, q.BoostVal.Value(), options)
+}
+
+// asSpanSearchers builds a SpanSearcher for each of clauses, erroring out
+// if any of them isn't a SpanQuery; this is how span_near/span_or reject a
+// plain, non-positional clause (e.g. a bare MatchQuery) at query time.
+func asSpanSearchers(ctx context.Context, clauses []Query, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) ([]search.SpanSearcher, error) {
+	rv := make([]search.SpanSearcher, 0, len(clauses))
+	for _, c := range clauses {
+		sq, ok := c.(SpanQuery)
+		if !ok {
+			return nil, fmt.Errorf("clause of type %T is not a span query", c)
+		}
+		ss, err := sq.SpanSearcher(ctx, i, m, options)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, ss)
+	}
+	return rv, nil
+}
+
+// SpanNearQuery matches documents where every one of Clauses has a span,
+// and those spans can be laid out within Slop positions of one another.
+// When InOrder is set, the spans must additionally appear in the same
+// order as Clauses. Clauses may themselves be span combinators, so near
+// queries can nest (e.g. a span_near of span_near's).
+type SpanNearQuery struct {
+	Clauses  []Query `json:"clauses"`
+	Slop     int     `json:"slop"`
+	InOrder  bool    `json:"in_order"`
+	BoostVal *Boost  `json:"boost,omitempty"`
+}
+
+// NewSpanNearQuery creates a SpanNearQuery requiring clauses' spans within
+// slop positions of each other.
+func NewSpanNearQuery(clauses []Query, slop int, inOrder bool) *SpanNearQuery {
+	return &SpanNearQuery{Clauses: clauses, Slop: slop, InOrder: inOrder}
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It's needed because Clauses is
+// typed as []Query, an interface encoding/json cannot instantiate on its
+// own; each clause is instead decoded via the registry-backed ParseQuery,
+// the same as BooleanQuery/ConjunctionQuery/DisjunctionQuery do for their
+// own Query-typed fields.
+func (q *SpanNearQuery) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Clauses  []json.RawMessage `json:"clauses"`
+		Slop     int               `json:"slop"`
+		InOrder  bool              `json:"in_order"`
+		BoostVal *Boost            `json:"boost,omitempty"`
+	}
+	if err := util.UnmarshalJSON(data, &tmp); err != nil {
+		return err
+	}
+	q.Clauses = make([]Query, 0, len(tmp.Clauses))
+	for _, raw := range tmp.Clauses {
+		cq, err := ParseQuery(raw)
+		if err != nil {
+			return err
+		}
+		q.Clauses = append(q.Clauses, cq)
+	}
+	q.Slop = tmp.Slop
+	q.InOrder = tmp.InOrder
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler; see SpanTermQuery.MarshalJSON.
+func (q *SpanNearQuery) MarshalJSON() ([]byte, error) {
+	type Alias SpanNearQuery
+	return MarshalQueryWithType(q, (*Alias)(q))
+}
+
+func (q *SpanNearQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanNearQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *SpanNearQuery) Validate() error {
+	if q.Slop < 0 {
+		return fmt.Errorf("span_near slop must be >= 0")
+	}
+	if len(q.Clauses) == 0 {
+		return fmt.Errorf("span_near must have at least one clause")
+	}
+	return nil
+}
+
+func (q *SpanNearQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	return q.SpanSearcher(ctx, i, m, options)
+}
+
+func (q *SpanNearQuery) SpanSearcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.SpanSearcher, error) {
+	clauses, err := asSpanSearchers(ctx, q.Clauses, i, m, options)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.NewSpanNearSearcher(ctx, clauses, q.Slop, q.InOrder, options)
+}
+
+// SpanOrQuery matches documents where at least one of Clauses has a span.
+type SpanOrQuery struct {
+	Clauses  []Query `json:"clauses"`
+	BoostVal *Boost  `json:"boost,omitempty"`
+}
+
+// NewSpanOrQuery creates a SpanOrQuery over clauses.
+func NewSpanOrQuery(clauses []Query) *SpanOrQuery {
+	return &SpanOrQuery{Clauses: clauses}
+}
+
+// UnmarshalJSON implements json.Unmarshaler; see SpanNearQuery.UnmarshalJSON.
+func (q *SpanOrQuery) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Clauses  []json.RawMessage `json:"clauses"`
+		BoostVal *Boost            `json:"boost,omitempty"`
+	}
+	if err := util.UnmarshalJSON(data, &tmp); err != nil {
+		return err
+	}
+	q.Clauses = make([]Query, 0, len(tmp.Clauses))
+	for _, raw := range tmp.Clauses {
+		cq, err := ParseQuery(raw)
+		if err != nil {
+			return err
+		}
+		q.Clauses = append(q.Clauses, cq)
+	}
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler; see SpanTermQuery.MarshalJSON.
+func (q *SpanOrQuery) MarshalJSON() ([]byte, error) {
+	type Alias SpanOrQuery
+	return MarshalQueryWithType(q, (*Alias)(q))
+}
+
+func (q *SpanOrQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanOrQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *SpanOrQuery) Validate() error {
+	if len(q.Clauses) == 0 {
+		return fmt.Errorf("span_or must have at least one clause")
+	}
+	return nil
+}
+
+func (q *SpanOrQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	return q.SpanSearcher(ctx, i, m, options)
+}
+
+func (q *SpanOrQuery) SpanSearcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.SpanSearcher, error) {
+	clauses, err := asSpanSearchers(ctx, q.Clauses, i, m, options)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.NewSpanOrSearcher(ctx, clauses, options)
+}
+
+// SpanNotQuery matches documents where Include has a span that, once
+// widened by Pre positions before and Post positions after, does not
+// overlap any span from Exclude.
+type SpanNotQuery struct {
+	Include  Query  `json:"include"`
+	Exclude  Query  `json:"exclude"`
+	Pre      int    `json:"pre"`
+	Post     int    `json:"post"`
+	BoostVal *Boost `json:"boost,omitempty"`
+}
+
+// NewSpanNotQuery creates a SpanNotQuery matching include's spans that
+// don't overlap exclude's, widened by pre/post positions.
+func NewSpanNotQuery(include, exclude Query, pre, post int) *SpanNotQuery {
+	return &SpanNotQuery{Include: include, Exclude: exclude, Pre: pre, Post: post}
+}
+
+// UnmarshalJSON implements json.Unmarshaler; see SpanNearQuery.UnmarshalJSON.
+func (q *SpanNotQuery) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Include  json.RawMessage `json:"include"`
+		Exclude  json.RawMessage `json:"exclude"`
+		Pre      int             `json:"pre"`
+		Post     int             `json:"post"`
+		BoostVal *Boost          `json:"boost,omitempty"`
+	}
+	if err := util.UnmarshalJSON(data, &tmp); err != nil {
+		return err
+	}
+	include, err := ParseQuery(tmp.Include)
+	if err != nil {
+		return err
+	}
+	exclude, err := ParseQuery(tmp.Exclude)
+	if err != nil {
+		return err
+	}
+	q.Include = include
+	q.Exclude = exclude
+	q.Pre = tmp.Pre
+	q.Post = tmp.Post
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler; see SpanTermQuery.MarshalJSON.
+func (q *SpanNotQuery) MarshalJSON() ([]byte, error) {
+	type Alias SpanNotQuery
+	return MarshalQueryWithType(q, (*Alias)(q))
+}
+
+func (q *SpanNotQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanNotQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *SpanNotQuery) Validate() error {
+	if q.Pre < 0 || q.Post < 0 {
+		return fmt.Errorf("span_not pre/post must be >= 0")
+	}
+	if q.Include == nil || q.Exclude == nil {
+		return fmt.Errorf("span_not requires both include and exclude")
+	}
+	return nil
+}
+
+func (q *SpanNotQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	return q.SpanSearcher(ctx, i, m, options)
+}
+
+func (q *SpanNotQuery) SpanSearcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.SpanSearcher, error) {
+	clauses, err := asSpanSearchers(ctx, []Query{q.Include, q.Exclude}, i, m, options)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.NewSpanNotSearcher(ctx, clauses[0], clauses[1], q.Pre, q.Post)
+}
+
+// SpanFirstQuery matches documents where Match has a span starting within
+// the first End positions of the field (positions start at 1, so a span
+// qualifies when its Start is at most End).
+type SpanFirstQuery struct {
+	Match    Query  `json:"match"`
+	End      int    `json:"end"`
+	BoostVal *Boost `json:"boost,omitempty"`
+}
+
+// NewSpanFirstQuery creates a SpanFirstQuery requiring match to start
+// within the first end positions.
+func NewSpanFirstQuery(match Query, end int) *SpanFirstQuery {
+	return &SpanFirstQuery{Match: match, End: end}
+}
+
+// UnmarshalJSON implements json.Unmarshaler; see SpanNearQuery.UnmarshalJSON.
+func (q *SpanFirstQuery) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Match    json.RawMessage `json:"match"`
+		End      int             `json:"end"`
+		BoostVal *Boost          `json:"boost,omitempty"`
+	}
+	if err := util.UnmarshalJSON(data, &tmp); err != nil {
+		return err
+	}
+	match, err := ParseQuery(tmp.Match)
+	if err != nil {
+		return err
+	}
+	q.Match = match
+	q.End = tmp.End
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler; see SpanTermQuery.MarshalJSON.
+func (q *SpanFirstQuery) MarshalJSON() ([]byte, error) {
+	type Alias SpanFirstQuery
+	return MarshalQueryWithType(q, (*Alias)(q))
+}
+
+func (q *SpanFirstQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanFirstQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *SpanFirstQuery) Validate() error {
+	if q.End < 0 {
+		return fmt.Errorf("span_first end must be >= 0")
+	}
+	if q.Match == nil {
+		return fmt.Errorf("span_first requires match")
+	}
+	return nil
+}
+
+func (q *SpanFirstQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	return q.SpanSearcher(ctx, i, m, options)
+}
+
+func (q *SpanFirstQuery) SpanSearcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.SpanSearcher, error) {
+	clauses, err := asSpanSearchers(ctx, []Query{q.Match}, i, m, options)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.NewSpanFirstSearcher(ctx, clauses[0], q.End)
+}
+
+func init() {
+	mustRegisterQueryType("span_term", func() Query { return &SpanTermQuery{} }, nil)
+	mustRegisterQueryType("span_near", func() Query { return &SpanNearQuery{} }, nil)
+	mustRegisterQueryType("span_or", func() Query { return &SpanOrQuery{} }, nil)
+	mustRegisterQueryType("span_not", func() Query { return &SpanNotQuery{} }, nil)
+	mustRegisterQueryType("span_first", func() Query { return &SpanFirstQuery{} }, nil)
+}
@@ -0,0 +1,197 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2/util"
+)
+
+// QueryTypeFactory returns a new, zero-valued instance of a registered Query
+// implementation, suitable as the target of json.Unmarshal.
+type QueryTypeFactory func() Query
+
+// QueryTypeDetector inspects the generic JSON object representation of a
+// query document and reports whether it describes the registered type. It
+// exists for backwards-compatibility with bleve's existing JSON query
+// shapes, most of which have no explicit discriminator and are instead
+// recognized by which keys are present (e.g. a "term" key means TermQuery).
+// New query types registered going forward should rely on the "type"
+// discriminator instead of a detector, but a detector may still be supplied
+// to accept legacy documents.
+type QueryTypeDetector func(map[string]interface{}) bool
+
+// queryTypeUnmarshalFunc decodes input into a Query of the registered type.
+// The default, used by RegisterQueryType, simply unmarshals input into the
+// value returned by the factory. RegisterQueryTypeCustom allows a type to
+// override this, which is needed by legacy shapes such as PhraseQuery,
+// whose "terms" key is ambiguous with MultiPhraseQuery and must be resolved
+// by attempting one and falling back to the other.
+type queryTypeUnmarshalFunc func(input []byte) (Query, error)
+
+type registeredQueryType struct {
+	name      string
+	factory   QueryTypeFactory
+	detect    QueryTypeDetector
+	unmarshal queryTypeUnmarshalFunc
+}
+
+var queryTypeRegistryMutex sync.RWMutex
+var queryTypeRegistry = map[string]*registeredQueryType{}
+
+// queryTypeOrder preserves registration order. When a document carries no
+// "type" discriminator, detectors are tried in this order, so builtin types
+// must be registered in the same order the original ParseQuery ladder
+// checked them for the legacy behavior to remain unchanged.
+var queryTypeOrder []string
+
+// queryTypeNameByGoType lets DumpQuery recover the registered name for a
+// concrete Query implementation, so the discriminator can be emitted on
+// marshal symmetrically with how it's consumed on unmarshal.
+var queryTypeNameByGoType = map[reflect.Type]string{}
+
+// RegisterQueryType makes a Query implementation available to ParseQuery
+// under the given name. name is the value ParseQuery expects in a
+// document's "type" field. factory must return a new zero-valued instance
+// of the type to decode into. detect is optional; supply it only to
+// recognize legacy documents that carry no "type" field.
+func RegisterQueryType(name string, factory QueryTypeFactory, detect QueryTypeDetector) error {
+	return registerQueryType(name, factory, detect, nil)
+}
+
+// RegisterQueryTypeCustom is like RegisterQueryType, but lets the caller
+// take over decoding entirely once the type has been selected by
+// discriminator or detector. It exists for types whose legacy JSON shape is
+// ambiguous with another registered type and must inspect the unmarshal
+// error to decide between them.
+func RegisterQueryTypeCustom(name string, detect QueryTypeDetector, unmarshal queryTypeUnmarshalFunc, sample Query) error {
+	return registerQueryType(name, func() Query { return sample }, detect, unmarshal)
+}
+
+func registerQueryType(name string, factory QueryTypeFactory, detect QueryTypeDetector, unmarshal queryTypeUnmarshalFunc) error {
+	queryTypeRegistryMutex.Lock()
+	defer queryTypeRegistryMutex.Unlock()
+
+	if _, existing := queryTypeRegistry[name]; existing {
+		return fmt.Errorf("query type '%s' already registered", name)
+	}
+
+	queryTypeRegistry[name] = &registeredQueryType{
+		name:      name,
+		factory:   factory,
+		detect:    detect,
+		unmarshal: unmarshal,
+	}
+	queryTypeOrder = append(queryTypeOrder, name)
+
+	goType := reflect.TypeOf(factory())
+	if _, exists := queryTypeNameByGoType[goType]; !exists {
+		queryTypeNameByGoType[goType] = name
+	}
+
+	return nil
+}
+
+// queryTypeName returns the name q was registered under, if any.
+func queryTypeName(q Query) (string, bool) {
+	queryTypeRegistryMutex.RLock()
+	defer queryTypeRegistryMutex.RUnlock()
+
+	name, ok := queryTypeNameByGoType[reflect.TypeOf(q)]
+	return name, ok
+}
+
+// parseQueryViaRegistry resolves input to a registered Query type. It
+// prefers the explicit "type" discriminator; absent one, it tries each
+// registered detector in registration order and uses the first match. It
+// returns (nil, nil) when nothing in the registry recognizes the document,
+// so callers can report a single "unknown query type" error.
+func parseQueryViaRegistry(input []byte, tmp map[string]interface{}) (Query, error) {
+	queryTypeRegistryMutex.RLock()
+	defer queryTypeRegistryMutex.RUnlock()
+
+	if typeName, ok := tmp["type"].(string); ok {
+		rqt, found := queryTypeRegistry[typeName]
+		if !found {
+			return nil, fmt.Errorf("unknown query type '%s'", typeName)
+		}
+		return decodeRegisteredQueryType(rqt, input)
+	}
+
+	for _, name := range queryTypeOrder {
+		rqt := queryTypeRegistry[name]
+		if rqt.detect == nil || !rqt.detect(tmp) {
+			continue
+		}
+		return decodeRegisteredQueryType(rqt, input)
+	}
+
+	return nil, nil
+}
+
+func decodeRegisteredQueryType(rqt *registeredQueryType, input []byte) (Query, error) {
+	if rqt.unmarshal != nil {
+		return rqt.unmarshal(input)
+	}
+	rv := rqt.factory()
+	if err := util.UnmarshalJSON(input, rv); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// MarshalQueryWithType marshals alias (typically q itself, cast to a defined
+// type sharing q's fields to avoid recursing back into a custom MarshalJSON,
+// e.g. `type Alias SpanTermQuery; MarshalQueryWithType(q, (*Alias)(q))`) and
+// stamps the result with q's registered "type" discriminator via
+// AddTypeDiscriminator. It exists so a query type's own MarshalJSON, needed
+// to round-trip through DumpQuery/ParseQuery when the type has no legacy
+// detector, is a one-line call instead of repeating the marshal-then-stamp
+// sequence.
+func MarshalQueryWithType(q Query, alias interface{}) ([]byte, error) {
+	raw, err := json.Marshal(alias)
+	if err != nil {
+		return nil, err
+	}
+	return AddTypeDiscriminator(q, raw)
+}
+
+// AddTypeDiscriminator sets the registry's "type" key for q on the already
+// marshaled JSON object raw, returning the updated document. It is a no-op,
+// returning raw unchanged, if q was never passed to RegisterQueryType(Custom).
+// Composite query types (boolean/conjunction/disjunction/phrase and the
+// like) that want their children to round-trip through DumpQuery with their
+// own discriminators should call this from their own MarshalJSON after
+// marshaling each child; types with no other special marshaling needs can
+// use MarshalQueryWithType instead.
+func AddTypeDiscriminator(q Query, raw []byte) ([]byte, error) {
+	name, ok := queryTypeName(q)
+	if !ok {
+		return raw, nil
+	}
+
+	var m map[string]interface{}
+	if err := util.UnmarshalJSON(raw, &m); err != nil {
+		return nil, err
+	}
+	if _, alreadySet := m["type"]; !alreadySet {
+		m["type"] = name
+	}
+	return json.Marshal(m)
+}
@@ -0,0 +1,108 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// dummyRegistryQuery is a minimal Query used only to exercise the registry
+// plumbing, independent of any real query type.
+type dummyRegistryQuery struct {
+	Val string `json:"val"`
+}
+
+func (q *dummyRegistryQuery) Searcher(ctx context.Context, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	return nil, nil
+}
+
+func TestRegisterQueryTypeRoundTrip(t *testing.T) {
+	err := RegisterQueryType("test_registry_dummy", func() Query { return &dummyRegistryQuery{} }, nil)
+	if err != nil {
+		t.Fatalf("RegisterQueryType: %v", err)
+	}
+
+	q := &dummyRegistryQuery{Val: "hello"}
+	raw, err := json.Marshal(q)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	raw, err = AddTypeDiscriminator(q, raw)
+	if err != nil {
+		t.Fatalf("AddTypeDiscriminator: %v", err)
+	}
+
+	parsed, err := ParseQuery(raw)
+	if err != nil {
+		t.Fatalf("ParseQuery: %v", err)
+	}
+	drq, ok := parsed.(*dummyRegistryQuery)
+	if !ok {
+		t.Fatalf("ParseQuery returned %T, want *dummyRegistryQuery", parsed)
+	}
+	if drq.Val != "hello" {
+		t.Fatalf("Val = %q, want %q", drq.Val, "hello")
+	}
+}
+
+func TestRegisterQueryTypeDuplicate(t *testing.T) {
+	err := RegisterQueryType("test_registry_duplicate", func() Query { return &dummyRegistryQuery{} }, nil)
+	if err != nil {
+		t.Fatalf("first RegisterQueryType: %v", err)
+	}
+	err = RegisterQueryType("test_registry_duplicate", func() Query { return &dummyRegistryQuery{} }, nil)
+	if err == nil {
+		t.Fatal("expected error registering the same query type name twice")
+	}
+}
+
+// dummyMarshalQuery is a Go type of its own, distinct from
+// dummyRegistryQuery, because the registry keeps the first name a Go type was
+// registered under and dummyRegistryQuery is already registered above.
+type dummyMarshalQuery struct {
+	dummyRegistryQuery
+}
+
+func TestMarshalQueryWithType(t *testing.T) {
+	err := RegisterQueryType("test_registry_marshal", func() Query { return &dummyMarshalQuery{} }, nil)
+	if err != nil {
+		t.Fatalf("RegisterQueryType: %v", err)
+	}
+
+	q := &dummyMarshalQuery{dummyRegistryQuery{Val: "world"}}
+	type Alias dummyMarshalQuery
+	raw, err := MarshalQueryWithType(q, (*Alias)(q))
+	if err != nil {
+		t.Fatalf("MarshalQueryWithType: %v", err)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if m["type"] != "test_registry_marshal" {
+		t.Fatalf("type = %v, want %q", m["type"], "test_registry_marshal")
+	}
+	if m["val"] != "world" {
+		t.Fatalf("val = %v, want %q", m["val"], "world")
+	}
+}
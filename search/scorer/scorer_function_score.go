@@ -0,0 +1,227 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorer
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/geo"
+	"github.com/blevesearch/bleve/v2/numeric"
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// FieldValue is the doc value FunctionScoreSearcher decodes and passes to
+// ScoreFunction.Evaluate: Numeric for plain numeric and date fields (dates
+// are indexed as numeric epoch values and decoded the same way), or Lon/Lat
+// for geopoint fields, whenever the owning ScoreFunction's IsGeo reports
+// true for the field being evaluated.
+type FieldValue struct {
+	Numeric  float64
+	Lon, Lat float64
+}
+
+// ScoreFunction is implemented by query.ScoreFunction so its
+// field_value_factor/gauss/exp/linear computation can be driven from here
+// without this package importing search/query (which imports this one).
+type ScoreFunction interface {
+	// Field names the doc value FunctionScoreSearcher should pass to
+	// Evaluate.
+	Field() string
+	// IsGeo reports whether Field names a geopoint field, so
+	// FunctionScoreSearcher decodes its doc value into FieldValue.Lon/Lat
+	// instead of FieldValue.Numeric.
+	IsGeo() bool
+	// Evaluate computes this function's contribution from value, the
+	// decoded doc value of Field for the document currently being scored.
+	Evaluate(value FieldValue) (float64, error)
+}
+
+// FunctionScoreSearcher wraps another Searcher, rewriting each hit's score
+// by combining it with one or more ScoreFunctions, which are themselves
+// evaluated against doc values fetched from indexReader as each hit is
+// collected.
+type FunctionScoreSearcher struct {
+	search.Searcher
+
+	indexReader index.IndexReader
+	functions   []ScoreFunction
+	scoreMode   string
+	boostMode   string
+}
+
+// NewFunctionScoreSearcher wraps inner, recombining its score with
+// functions per scoreMode ("multiply", "sum", "avg", "first", "max",
+// "min"; default "multiply") and boostMode ("multiply", "replace", "sum",
+// "avg", "max", "min"; default "multiply").
+func NewFunctionScoreSearcher(inner search.Searcher, indexReader index.IndexReader,
+	functions []ScoreFunction, scoreMode, boostMode string) (*FunctionScoreSearcher, error) {
+	return &FunctionScoreSearcher{
+		Searcher:    inner,
+		indexReader: indexReader,
+		functions:   functions,
+		scoreMode:   scoreMode,
+		boostMode:   boostMode,
+	}, nil
+}
+
+func (s *FunctionScoreSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.Searcher.Next(ctx)
+	if err != nil || dm == nil {
+		return dm, err
+	}
+	return s.rescore(dm)
+}
+
+func (s *FunctionScoreSearcher) Advance(ctx *search.SearchContext, docID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.Searcher.Advance(ctx, docID)
+	if err != nil || dm == nil {
+		return dm, err
+	}
+	return s.rescore(dm)
+}
+
+func (s *FunctionScoreSearcher) rescore(dm *search.DocumentMatch) (*search.DocumentMatch, error) {
+	if len(s.functions) == 0 {
+		return dm, nil
+	}
+
+	values := make([]float64, len(s.functions))
+	for idx, fn := range s.functions {
+		fieldValue, err := s.docValue(dm.IndexInternalID, fn.Field(), fn.IsGeo())
+		if err != nil {
+			return nil, err
+		}
+		values[idx], err = fn.Evaluate(fieldValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dm.Score = combineBoost(s.boostMode, dm.Score, combineScores(s.scoreMode, values))
+	return dm, nil
+}
+
+// docValue reads field's single doc value for id. Numeric and date fields
+// are stored the same way, prefix-coded for range comparison, and decoded
+// back to a float64 via numeric.PrefixCoded/Int64ToFloat64 - dates as their
+// epoch value, same as every other numeric facet/sort reader in this
+// codebase. Geopoint fields additionally Morton-interleave longitude and
+// latitude into that same coded int64, so when isGeo is set the decoded
+// value is unhashed back into lon/lat instead.
+func (s *FunctionScoreSearcher) docValue(id index.IndexInternalID, field string, isGeo bool) (FieldValue, error) {
+	dvReader, err := s.indexReader.DocValueReader([]string{field})
+	if err != nil {
+		return FieldValue{}, err
+	}
+
+	var value FieldValue
+	var found bool
+	var decodeErr error
+	err = dvReader.VisitDocValues(id, func(f string, term []byte) {
+		if found || decodeErr != nil || f != field {
+			return
+		}
+		i, err := numeric.PrefixCoded(term).Int64()
+		if err != nil {
+			decodeErr = fmt.Errorf("function_score: decoding doc value for field '%s': %w", field, err)
+			return
+		}
+		if isGeo {
+			hash := uint64(i)
+			value = FieldValue{Lon: geo.MortonUnhashLon(hash), Lat: geo.MortonUnhashLat(hash)}
+		} else {
+			value = FieldValue{Numeric: numeric.Int64ToFloat64(i)}
+		}
+		found = true
+	})
+	if err != nil {
+		return FieldValue{}, err
+	}
+	if decodeErr != nil {
+		return FieldValue{}, decodeErr
+	}
+	if !found {
+		return FieldValue{}, fmt.Errorf("function_score: no doc value for field '%s'", field)
+	}
+	return value, nil
+}
+
+func combineScores(mode string, values []float64) float64 {
+	if len(values) == 0 {
+		return 1
+	}
+	switch mode {
+	case "sum":
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	case "avg":
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	case "first":
+		return values[0]
+	case "max":
+		m := values[0]
+		for _, v := range values[1:] {
+			if v > m {
+				m = v
+			}
+		}
+		return m
+	case "min":
+		m := values[0]
+		for _, v := range values[1:] {
+			if v < m {
+				m = v
+			}
+		}
+		return m
+	default: // "multiply", "" (default)
+		p := 1.0
+		for _, v := range values {
+			p *= v
+		}
+		return p
+	}
+}
+
+func combineBoost(mode string, base, fn float64) float64 {
+	switch mode {
+	case "replace":
+		return fn
+	case "sum":
+		return base + fn
+	case "avg":
+		return (base + fn) / 2
+	case "max":
+		if fn > base {
+			return fn
+		}
+		return base
+	case "min":
+		if fn < base {
+			return fn
+		}
+		return base
+	default: // "multiply", "" (default)
+		return base * fn
+	}
+}
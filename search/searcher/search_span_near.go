@@ -0,0 +1,143 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"context"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// SpanNearSearcher matches documents where every clause's spans can be laid
+// out within slop positions of each other, honoring inOrder when set. A
+// ConjunctionSearcher over the clauses' underlying Searchers narrows
+// candidate documents exactly as PhraseSearcher does; SpanNearSearcher adds
+// the positional check on top, and drops any document for which no
+// qualifying combination of spans exists.
+type SpanNearSearcher struct {
+	*ConjunctionSearcher
+
+	clauses []search.SpanSearcher
+	slop    int
+	inOrder bool
+	spans   []search.Span
+}
+
+// NewSpanNearSearcher requires at least one clause; slop must be >= 0.
+func NewSpanNearSearcher(ctx context.Context, clauses []search.SpanSearcher, slop int, inOrder bool,
+	options search.SearcherOptions) (*SpanNearSearcher, error) {
+	searchers := make([]search.Searcher, 0, len(clauses))
+	for _, c := range clauses {
+		searchers = append(searchers, c)
+	}
+	cs, err := NewConjunctionSearcher(ctx, searchers, options)
+	if err != nil {
+		return nil, err
+	}
+	return &SpanNearSearcher{
+		ConjunctionSearcher: cs,
+		clauses:             clauses,
+		slop:                slop,
+		inOrder:             inOrder,
+	}, nil
+}
+
+// Next implements search.Searcher, skipping any ConjunctionSearcher match
+// whose clauses have no combination of spans within slop of each other.
+func (s *SpanNearSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.ConjunctionSearcher.Next(ctx)
+	for dm != nil && err == nil {
+		if spans, ok := s.combine(); ok {
+			s.spans = spans
+			return dm, nil
+		}
+		dm, err = s.ConjunctionSearcher.Next(ctx)
+	}
+	return dm, err
+}
+
+// Advance implements search.Searcher the same way Next does: it advances
+// past the requested document if it doesn't satisfy the span_near rule.
+func (s *SpanNearSearcher) Advance(ctx *search.SearchContext, docID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.ConjunctionSearcher.Advance(ctx, docID)
+	for dm != nil && err == nil {
+		if spans, ok := s.combine(); ok {
+			s.spans = spans
+			return dm, nil
+		}
+		dm, err = s.ConjunctionSearcher.Next(ctx)
+	}
+	return dm, err
+}
+
+// combine looks for one span per clause, in clause order, such that
+// consecutive spans are within slop positions of each other (and, when
+// inOrder is set, each clause's span starts no earlier than the previous
+// clause's). It returns the first qualifying combination it finds, which
+// is sufficient to decide the document matches; it isn't meant to
+// enumerate every possible combination.
+func (s *SpanNearSearcher) combine() ([]search.Span, bool) {
+	var best []search.Span
+	var search2 func(i int, prev *search.Span, acc []search.Span) bool
+	search2 = func(i int, prev *search.Span, acc []search.Span) bool {
+		if i == len(s.clauses) {
+			best = append([]search.Span{}, acc...)
+			return true
+		}
+		it := s.clauses[i].Spans()
+		for sp := it.Next(); sp != nil; sp = it.Next() {
+			if prev != nil {
+				if s.inOrder && sp.Start < prev.Start {
+					continue
+				}
+				gap := gapBetween(*prev, *sp)
+				if gap > s.slop {
+					continue
+				}
+			}
+			if search2(i+1, sp, append(acc, *sp)) {
+				return true
+			}
+		}
+		return false
+	}
+	if search2(0, nil, nil) {
+		sort.Slice(best, func(i, j int) bool { return best[i].Start < best[j].Start })
+		return best, true
+	}
+	return nil, false
+}
+
+// gapBetween returns the number of unmatched positions separating a and b,
+// regardless of which comes first; this is what slop bounds.
+func gapBetween(a, b search.Span) int {
+	var gap int64
+	if b.Start > a.End {
+		gap = int64(b.Start) - int64(a.End) - 1
+	} else if a.Start > b.End {
+		gap = int64(a.Start) - int64(b.End) - 1
+	}
+	if gap < 0 {
+		gap = 0
+	}
+	return int(gap)
+}
+
+// Spans implements search.SpanSearcher.
+func (s *SpanNearSearcher) Spans() search.SpanIterator {
+	return search.NewSliceSpanIterator(s.spans)
+}
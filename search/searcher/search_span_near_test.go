@@ -0,0 +1,38 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/search"
+)
+
+func TestGapBetween(t *testing.T) {
+	tests := []struct {
+		a, b search.Span
+		want int
+	}{
+		{search.Span{Start: 0, End: 0}, search.Span{Start: 1, End: 1}, 0},
+		{search.Span{Start: 0, End: 0}, search.Span{Start: 2, End: 2}, 1},
+		{search.Span{Start: 0, End: 2}, search.Span{Start: 2, End: 4}, 0},
+		{search.Span{Start: 5, End: 5}, search.Span{Start: 0, End: 0}, 4},
+	}
+	for _, tc := range tests {
+		if got := gapBetween(tc.a, tc.b); got != tc.want {
+			t.Errorf("gapBetween(%+v, %+v) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
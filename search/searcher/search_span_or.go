@@ -0,0 +1,223 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"context"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// SpanOrSearcher matches any document at least one clause matches, and
+// reports the union of whichever clauses' spans are present for that
+// document. It's a thin positional layer over DisjunctionSearcher, which
+// already does the doc-level union.
+type SpanOrSearcher struct {
+	*DisjunctionSearcher
+
+	clauses []search.SpanSearcher
+}
+
+func NewSpanOrSearcher(ctx context.Context, clauses []search.SpanSearcher,
+	options search.SearcherOptions) (*SpanOrSearcher, error) {
+	searchers := make([]search.Searcher, 0, len(clauses))
+	for _, c := range clauses {
+		searchers = append(searchers, c)
+	}
+	ds, err := NewDisjunctionSearcher(ctx, searchers, 1, options)
+	if err != nil {
+		return nil, err
+	}
+	return &SpanOrSearcher{
+		DisjunctionSearcher: ds,
+		clauses:             clauses,
+	}, nil
+}
+
+// Spans implements search.SpanSearcher, merging every clause's spans for
+// the current document into Start order.
+func (s *SpanOrSearcher) Spans() search.SpanIterator {
+	var all []search.Span
+	for _, c := range s.clauses {
+		it := c.Spans()
+		for sp := it.Next(); sp != nil; sp = it.Next() {
+			all = append(all, *sp)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Start < all[j].Start })
+	return search.NewSliceSpanIterator(all)
+}
+
+// SpanNotSearcher matches documents where Include has a span that, after
+// widening it by Pre positions before and Post positions after, does not
+// overlap any span from Exclude. It is built as a decorator over Include's
+// underlying Searcher, since Exclude never contributes documents on its
+// own, only vetoes positions within ones Include already matched.
+type SpanNotSearcher struct {
+	search.SpanSearcher
+
+	include search.SpanSearcher
+	exclude search.SpanSearcher
+	pre     int
+	post    int
+	spans   []search.Span
+}
+
+// NewSpanNotSearcher requires pre >= 0 and post >= 0.
+func NewSpanNotSearcher(ctx context.Context, include, exclude search.SpanSearcher,
+	pre, post int) (*SpanNotSearcher, error) {
+	return &SpanNotSearcher{
+		SpanSearcher: include,
+		include:      include,
+		exclude:      exclude,
+		pre:          pre,
+		post:         post,
+	}, nil
+}
+
+func (s *SpanNotSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.include.Next(ctx)
+	for dm != nil && err == nil {
+		if spans, ok := s.filtered(dm, ctx); ok {
+			s.spans = spans
+			return dm, nil
+		}
+		dm, err = s.include.Next(ctx)
+	}
+	return dm, err
+}
+
+func (s *SpanNotSearcher) Advance(ctx *search.SearchContext, docID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.include.Advance(ctx, docID)
+	for dm != nil && err == nil {
+		if spans, ok := s.filtered(dm, ctx); ok {
+			s.spans = spans
+			return dm, nil
+		}
+		dm, err = s.include.Next(ctx)
+	}
+	return dm, err
+}
+
+// filtered returns the subset of include's spans for dm that survive
+// widening and comparison against exclude's spans for the same document,
+// fetched by advancing exclude to dm's ID. A document is kept only if at
+// least one included span survives.
+func (s *SpanNotSearcher) filtered(dm *search.DocumentMatch, ctx *search.SearchContext) ([]search.Span, bool) {
+	var excluded []search.Span
+	if xdm, err := s.exclude.Advance(ctx, dm.IndexInternalID); err == nil && xdm != nil &&
+		xdm.IndexInternalID.Equals(dm.IndexInternalID) {
+		it := s.exclude.Spans()
+		for sp := it.Next(); sp != nil; sp = it.Next() {
+			excluded = append(excluded, *sp)
+		}
+	}
+
+	var kept []search.Span
+	it := s.include.Spans()
+	for sp := it.Next(); sp != nil; sp = it.Next() {
+		start := uint64(0)
+		if sp.Start > uint64(s.pre) {
+			start = sp.Start - uint64(s.pre)
+		}
+		widened := search.Span{Start: start, End: sp.End + uint64(s.post)}
+		overlapsExcluded := false
+		for _, x := range excluded {
+			if widened.Overlaps(x) {
+				overlapsExcluded = true
+				break
+			}
+		}
+		if !overlapsExcluded {
+			kept = append(kept, *sp)
+		}
+	}
+	return kept, len(kept) > 0
+}
+
+func (s *SpanNotSearcher) Spans() search.SpanIterator {
+	return search.NewSliceSpanIterator(s.spans)
+}
+
+// Close closes both include and exclude. The embedded search.SpanSearcher
+// only reaches include, so without this override exclude's resources would
+// never be released.
+func (s *SpanNotSearcher) Close() error {
+	err := s.include.Close()
+	if excludeErr := s.exclude.Close(); err == nil {
+		err = excludeErr
+	}
+	return err
+}
+
+// SpanFirstSearcher matches documents where Inner has a span that starts
+// within the first End positions of the field, i.e. at a Start no greater
+// than End, since span positions follow Location.Pos and start at 1.
+type SpanFirstSearcher struct {
+	search.SpanSearcher
+
+	inner search.SpanSearcher
+	end   int
+	spans []search.Span
+}
+
+func NewSpanFirstSearcher(ctx context.Context, inner search.SpanSearcher, end int) (*SpanFirstSearcher, error) {
+	return &SpanFirstSearcher{
+		SpanSearcher: inner,
+		inner:        inner,
+		end:          end,
+	}, nil
+}
+
+func (s *SpanFirstSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.inner.Next(ctx)
+	for dm != nil && err == nil {
+		if spans, ok := s.leading(); ok {
+			s.spans = spans
+			return dm, nil
+		}
+		dm, err = s.inner.Next(ctx)
+	}
+	return dm, err
+}
+
+func (s *SpanFirstSearcher) Advance(ctx *search.SearchContext, docID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.inner.Advance(ctx, docID)
+	for dm != nil && err == nil {
+		if spans, ok := s.leading(); ok {
+			s.spans = spans
+			return dm, nil
+		}
+		dm, err = s.inner.Next(ctx)
+	}
+	return dm, err
+}
+
+func (s *SpanFirstSearcher) leading() ([]search.Span, bool) {
+	var kept []search.Span
+	it := s.inner.Spans()
+	for sp := it.Next(); sp != nil; sp = it.Next() {
+		if int(sp.Start) <= s.end {
+			kept = append(kept, *sp)
+		}
+	}
+	return kept, len(kept) > 0
+}
+
+func (s *SpanFirstSearcher) Spans() search.SpanIterator {
+	return search.NewSliceSpanIterator(s.spans)
+}
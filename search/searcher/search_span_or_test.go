@@ -0,0 +1,190 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// fakeSpanSearcher is a search.SpanSearcher stand-in driven by a fixed list
+// of per-document spans, in ascending IndexInternalID order, used so the
+// span combinators (SpanOrSearcher, SpanNotSearcher, SpanFirstSearcher) can
+// be exercised end-to-end - matched against documents and their spans -
+// without needing a real index.
+type fakeSpanSearcher struct {
+	docs []fakeSpanDoc
+	pos  int
+}
+
+type fakeSpanDoc struct {
+	id    string
+	spans []search.Span
+}
+
+func newFakeSpanSearcher(docs ...fakeSpanDoc) *fakeSpanSearcher {
+	return &fakeSpanSearcher{docs: docs}
+}
+
+func (s *fakeSpanSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	if s.pos >= len(s.docs) {
+		return nil, nil
+	}
+	d := s.docs[s.pos]
+	s.pos++
+	return &search.DocumentMatch{IndexInternalID: index.IndexInternalID(d.id)}, nil
+}
+
+func (s *fakeSpanSearcher) Advance(ctx *search.SearchContext, docID index.IndexInternalID) (*search.DocumentMatch, error) {
+	for s.pos < len(s.docs) && s.docs[s.pos].id < string(docID) {
+		s.pos++
+	}
+	if s.pos >= len(s.docs) || s.docs[s.pos].id != string(docID) {
+		return nil, nil
+	}
+	d := s.docs[s.pos]
+	s.pos++
+	return &search.DocumentMatch{IndexInternalID: index.IndexInternalID(d.id)}, nil
+}
+
+func (s *fakeSpanSearcher) Close() error              { return nil }
+func (s *fakeSpanSearcher) Weight() float64           { return 1 }
+func (s *fakeSpanSearcher) SetQueryNorm(float64)      {}
+func (s *fakeSpanSearcher) Count() uint64             { return uint64(len(s.docs)) }
+func (s *fakeSpanSearcher) Min() int                  { return 0 }
+func (s *fakeSpanSearcher) Size() int                 { return 1 }
+func (s *fakeSpanSearcher) DocumentMatchPoolSize() int { return 1 }
+
+func (s *fakeSpanSearcher) Spans() search.SpanIterator {
+	if s.pos == 0 || s.pos-1 >= len(s.docs) {
+		return search.NewSliceSpanIterator(nil)
+	}
+	return search.NewSliceSpanIterator(s.docs[s.pos-1].spans)
+}
+
+func TestSpanNotSearcherExcludesOverlappingSpans(t *testing.T) {
+	include := newFakeSpanSearcher(
+		fakeSpanDoc{id: "1", spans: []search.Span{{Start: 2, End: 2}}},
+		fakeSpanDoc{id: "2", spans: []search.Span{{Start: 10, End: 10}}},
+	)
+	exclude := newFakeSpanSearcher(
+		fakeSpanDoc{id: "1", spans: []search.Span{{Start: 2, End: 2}}},
+	)
+
+	s, err := NewSpanNotSearcher(context.Background(), include, exclude, 0, 0)
+	if err != nil {
+		t.Fatalf("NewSpanNotSearcher: %v", err)
+	}
+
+	var matched []string
+	ctx := &search.SearchContext{}
+	for dm, err := s.Next(ctx); dm != nil; dm, err = s.Next(ctx) {
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		matched = append(matched, string(dm.IndexInternalID))
+	}
+
+	if len(matched) != 1 || matched[0] != "2" {
+		t.Fatalf("matched = %v, want [2] (doc 1's only span overlaps exclude's)", matched)
+	}
+}
+
+func TestSpanNotSearcherWidensIncludeBeforeComparing(t *testing.T) {
+	// include's span is at position 5; exclude sits at position 4, one
+	// before it. With pre=0 there's no overlap and the doc matches; with
+	// pre=1 the widened span covers 4-5 and the doc is excluded.
+	newSearchers := func(pre int) *SpanNotSearcher {
+		include := newFakeSpanSearcher(fakeSpanDoc{id: "1", spans: []search.Span{{Start: 5, End: 5}}})
+		exclude := newFakeSpanSearcher(fakeSpanDoc{id: "1", spans: []search.Span{{Start: 4, End: 4}}})
+		s, err := NewSpanNotSearcher(context.Background(), include, exclude, pre, 0)
+		if err != nil {
+			t.Fatalf("NewSpanNotSearcher: %v", err)
+		}
+		return s
+	}
+
+	ctx := &search.SearchContext{}
+	if dm, err := newSearchers(0).Next(ctx); err != nil || dm == nil {
+		t.Fatalf("pre=0: expected a match, got dm=%v err=%v", dm, err)
+	}
+	if dm, err := newSearchers(1).Next(ctx); err != nil || dm != nil {
+		t.Fatalf("pre=1: expected no match (widened span excluded), got dm=%v err=%v", dm, err)
+	}
+}
+
+func TestSpanFirstSearcherKeepsOnlyLeadingSpans(t *testing.T) {
+	inner := newFakeSpanSearcher(
+		fakeSpanDoc{id: "1", spans: []search.Span{{Start: 0, End: 0}, {Start: 5, End: 5}}},
+		fakeSpanDoc{id: "2", spans: []search.Span{{Start: 5, End: 5}}},
+	)
+	s, err := NewSpanFirstSearcher(context.Background(), inner, 3)
+	if err != nil {
+		t.Fatalf("NewSpanFirstSearcher: %v", err)
+	}
+
+	ctx := &search.SearchContext{}
+	var matched []string
+	for dm, err := s.Next(ctx); dm != nil; dm, err = s.Next(ctx) {
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		matched = append(matched, string(dm.IndexInternalID))
+		it := s.Spans()
+		count := 0
+		for sp := it.Next(); sp != nil; sp = it.Next() {
+			if sp.Start > 3 {
+				t.Fatalf("doc %s: kept span starting at %d, want <= 3", string(dm.IndexInternalID), sp.Start)
+			}
+			count++
+		}
+		if count != 1 {
+			t.Fatalf("doc %s: kept %d spans, want exactly 1", string(dm.IndexInternalID), count)
+		}
+	}
+
+	if len(matched) != 1 || matched[0] != "1" {
+		t.Fatalf("matched = %v, want [1] (doc 2's only span starts at 5, past end=3)", matched)
+	}
+}
+
+func TestSpanOrSearcherMergesClauseSpans(t *testing.T) {
+	// This drives Spans() directly against a SpanOrSearcher whose clauses
+	// are both positioned on document 1, without going through the
+	// embedded DisjunctionSearcher's Next/Advance.
+	a := newFakeSpanSearcher(fakeSpanDoc{id: "1", spans: []search.Span{{Start: 5, End: 5}}})
+	b := newFakeSpanSearcher(fakeSpanDoc{id: "1", spans: []search.Span{{Start: 1, End: 1}}})
+	ctx := &search.SearchContext{}
+	if _, err := a.Next(ctx); err != nil {
+		t.Fatalf("a.Next: %v", err)
+	}
+	if _, err := b.Next(ctx); err != nil {
+		t.Fatalf("b.Next: %v", err)
+	}
+
+	s := &SpanOrSearcher{clauses: []search.SpanSearcher{a, b}}
+
+	it := s.Spans()
+	var starts []uint64
+	for sp := it.Next(); sp != nil; sp = it.Next() {
+		starts = append(starts, sp.Start)
+	}
+	if len(starts) != 2 || starts[0] != 1 || starts[1] != 5 {
+		t.Fatalf("merged spans = %v, want [1 5] sorted by Start", starts)
+	}
+}
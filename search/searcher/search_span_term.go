@@ -0,0 +1,102 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"context"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// SpanTermSearcher is a TermSearcher that additionally satisfies
+// search.SpanSearcher, so it can sit at the leaves of a span_near/span_or/
+// span_not/span_first tree. It reports spans by reading the term locations
+// the embedded TermSearcher already populates on each DocumentMatch, the
+// same locations the phrase searcher uses to verify adjacency.
+type SpanTermSearcher struct {
+	*TermSearcher
+
+	field string
+	term  string
+	last  *search.DocumentMatch
+}
+
+// NewSpanTermSearcher constructs a SpanTermSearcher equivalent to a
+// TermSearcher over field/term, but whose Spans() reports the matched
+// term's positions within the current document.
+func NewSpanTermSearcher(ctx context.Context, indexReader index.IndexReader,
+	term string, field string, boost float64, options search.SearcherOptions) (*SpanTermSearcher, error) {
+	// Spans() depends on dm.Locations, which the index only populates when
+	// term vectors are requested; force that on regardless of what the
+	// caller asked for, the same way the phrase searcher does for its own
+	// locations-dependent adjacency check.
+	options.IncludeTermVectors = true
+	ts, err := NewTermSearcher(ctx, indexReader, term, field, boost, options)
+	if err != nil {
+		return nil, err
+	}
+	return &SpanTermSearcher{
+		TermSearcher: ts,
+		field:        field,
+		term:         term,
+	}, nil
+}
+
+// Next implements search.Searcher, caching the match so Spans() can
+// describe it.
+func (s *SpanTermSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.TermSearcher.Next(ctx)
+	s.last = dm
+	return dm, err
+}
+
+// Advance implements search.Searcher, caching the match so Spans() can
+// describe it.
+func (s *SpanTermSearcher) Advance(ctx *search.SearchContext, docID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.TermSearcher.Advance(ctx, docID)
+	s.last = dm
+	return dm, err
+}
+
+// Spans implements search.SpanSearcher.
+func (s *SpanTermSearcher) Spans() search.SpanIterator {
+	return search.NewSliceSpanIterator(locationsToSpans(s.last, s.field, s.term))
+}
+
+// locationsToSpans extracts the Span for every occurrence of term in field
+// within dm, sorted by starting position. It is shared by all of the span
+// combinators in this package, since each of them ultimately bottoms out at
+// a SpanTermSearcher leaf.
+func locationsToSpans(dm *search.DocumentMatch, field string, term string) []search.Span {
+	if dm == nil {
+		return nil
+	}
+	fieldLocations, ok := dm.Locations[field]
+	if !ok {
+		return nil
+	}
+	termLocations, ok := fieldLocations[term]
+	if !ok {
+		return nil
+	}
+	spans := make([]search.Span, 0, len(termLocations))
+	for _, loc := range termLocations {
+		spans = append(spans, search.Span{Start: loc.Pos, End: loc.Pos})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	return spans
+}
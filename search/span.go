@@ -0,0 +1,80 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+// Span represents a single matched interval of term positions within one
+// field of the document currently under consideration, using the same
+// position numbering as Location.Pos. Start and End are both inclusive, so
+// a single-term match has Start == End.
+type Span struct {
+	Start uint64
+	End   uint64
+}
+
+// Overlaps reports whether s and other share at least one position.
+func (s Span) Overlaps(other Span) bool {
+	return s.Start <= other.End && other.Start <= s.End
+}
+
+// SpanIterator walks the Spans a SpanSearcher contributed towards the
+// document most recently returned by its Next/Advance, in ascending
+// Start order. It is reset implicitly every time the underlying
+// SpanSearcher advances to a new document.
+type SpanIterator interface {
+	// Next returns the next Span, or nil once exhausted.
+	Next() *Span
+}
+
+// sliceSpanIterator adapts a pre-computed, sorted []Span to SpanIterator.
+// It's the iterator implementation every SpanSearcher in bleve returns,
+// since spans are determined per-document from position postings/locations
+// already resident in memory rather than streamed.
+type sliceSpanIterator struct {
+	spans []Span
+	pos   int
+}
+
+// NewSliceSpanIterator returns a SpanIterator over spans, which must
+// already be sorted by Start; callers combining multiple SpanIterators are
+// responsible for maintaining that order.
+func NewSliceSpanIterator(spans []Span) SpanIterator {
+	return &sliceSpanIterator{spans: spans}
+}
+
+func (s *sliceSpanIterator) Next() *Span {
+	if s.pos >= len(s.spans) {
+		return nil
+	}
+	rv := &s.spans[s.pos]
+	s.pos++
+	return rv
+}
+
+// SpanSearcher is implemented by Searchers that, in addition to the usual
+// per-hit scoring, can report the position intervals responsible for a
+// document's match. The span query family (span_term, span_near, span_or,
+// span_not, span_first) is built as a combinator layer over other
+// SpanSearchers, narrowing candidate documents much like a Boolean/
+// Conjunction/Disjunction searcher does, but filtering and combining spans
+// per document rather than just document numbers.
+type SpanSearcher interface {
+	Searcher
+
+	// Spans returns an iterator over the position intervals that caused
+	// the document most recently returned by Next/Advance to match. It is
+	// only valid to call after Next/Advance has returned a non-nil
+	// DocumentMatch.
+	Spans() SpanIterator
+}
@@ -0,0 +1,55 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import "testing"
+
+func TestSpanOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b Span
+		want bool
+	}{
+		{Span{Start: 0, End: 0}, Span{Start: 0, End: 0}, true},
+		{Span{Start: 0, End: 2}, Span{Start: 2, End: 4}, true},
+		{Span{Start: 0, End: 1}, Span{Start: 2, End: 4}, false},
+		{Span{Start: 5, End: 10}, Span{Start: 0, End: 4}, false},
+		{Span{Start: 5, End: 10}, Span{Start: 0, End: 5}, true},
+	}
+	for _, tc := range tests {
+		if got := tc.a.Overlaps(tc.b); got != tc.want {
+			t.Errorf("%+v.Overlaps(%+v) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+		if got := tc.b.Overlaps(tc.a); got != tc.want {
+			t.Errorf("%+v.Overlaps(%+v) = %v, want %v", tc.b, tc.a, got, tc.want)
+		}
+	}
+}
+
+func TestSliceSpanIterator(t *testing.T) {
+	spans := []Span{{Start: 0, End: 0}, {Start: 2, End: 3}}
+	it := NewSliceSpanIterator(spans)
+
+	got := it.Next()
+	if got == nil || *got != spans[0] {
+		t.Fatalf("first Next() = %v, want %v", got, spans[0])
+	}
+	got = it.Next()
+	if got == nil || *got != spans[1] {
+		t.Fatalf("second Next() = %v, want %v", got, spans[1])
+	}
+	if got := it.Next(); got != nil {
+		t.Fatalf("third Next() = %v, want nil", got)
+	}
+}